@@ -0,0 +1,131 @@
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CommandArgs are the arguments of a command found in a comment, e.g.
+// `/deploy staging --force tag=v1.2` gives positional [staging] and options
+// {force: true, tag: v1.2}.
+type CommandArgs struct {
+	// Captures are the named capture groups of the command pattern.
+	Captures map[string]string `json:"captures"`
+	// Positional are the arguments following the match on its line.
+	Positional []string `json:"positional"`
+	// Options are the --key=value, --flag and key=value arguments.
+	Options map[string]string `json:"options"`
+}
+
+var optionKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// ParseCommandArgs finds pattern in comment and parses the rest of the
+// matched line with a shell-like grammar: arguments are separated by spaces
+// and may be quoted with ' or " or escaped with \.
+func ParseCommandArgs(pattern *regexp.Regexp, comment string) (*CommandArgs, error) {
+	args := &CommandArgs{
+		Captures:   make(map[string]string),
+		Positional: []string{},
+		Options:    make(map[string]string),
+	}
+	match := pattern.FindStringSubmatchIndex(comment)
+	if match == nil {
+		return args, nil
+	}
+	for i, name := range pattern.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		args.Captures[name] = comment[match[2*i]:match[2*i+1]]
+	}
+
+	rest := comment[match[1]:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	words, err := splitWords(rest)
+	if err != nil {
+		return nil, err
+	}
+	endOfOptions := false
+	for _, word := range words {
+		if endOfOptions {
+			args.Positional = append(args.Positional, word)
+			continue
+		}
+		if word == "--" {
+			endOfOptions = true
+			continue
+		}
+		key, value := word, "true"
+		dashed := strings.HasPrefix(key, "--")
+		key = strings.TrimPrefix(key, "--")
+		if i := strings.IndexByte(key, '='); i >= 0 {
+			key, value = key[:i], key[i+1:]
+		} else if !dashed {
+			args.Positional = append(args.Positional, word)
+			continue
+		}
+		if !optionKey.MatchString(key) {
+			args.Positional = append(args.Positional, word)
+			continue
+		}
+		args.Options[key] = value
+	}
+	return args, nil
+}
+
+// splitWords splits s into words like a POSIX shell without expansions.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
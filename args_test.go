@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "  a\tb  c ", want: []string{"a", "b", "c"}},
+		{in: `'a b' "c d"`, want: []string{"a b", "c d"}},
+		{in: `a\ b`, want: []string{"a b"}},
+		{in: `"a \"b\""`, want: []string{`a "b"`}},
+		{in: `'a \ b'`, want: []string{`a \ b`}},
+		{in: `''`, want: []string{""}},
+		{in: `x"y z"w`, want: []string{"xy zw"}},
+		{in: `'open`, wantErr: true},
+		{in: `"open`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := splitWords(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitWords(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseCommandArgs(t *testing.T) {
+	tests := []struct {
+		pattern string
+		comment string
+		want    *CommandArgs
+	}{
+		{
+			pattern: `/deploy`,
+			comment: "/deploy staging --force tag=v1.2",
+			want: &CommandArgs{
+				Captures:   map[string]string{},
+				Positional: []string{"staging"},
+				Options:    map[string]string{"force": "true", "tag": "v1.2"},
+			},
+		},
+		{
+			pattern: `/deploy (?P<env>\w+)`,
+			comment: "please\n/deploy prod --region='us east'\nthanks --ignored",
+			want: &CommandArgs{
+				Captures:   map[string]string{"env": "prod"},
+				Positional: []string{},
+				Options:    map[string]string{"region": "us east"},
+			},
+		},
+		{
+			pattern: `/run`,
+			comment: "/run --dry -- --not-an-option a=b",
+			want: &CommandArgs{
+				Captures:   map[string]string{},
+				Positional: []string{"--not-an-option", "a=b"},
+				Options:    map[string]string{"dry": "true"},
+			},
+		},
+		{
+			pattern: `/run`,
+			comment: "/run =x --=y 1a=b",
+			want: &CommandArgs{
+				Captures:   map[string]string{},
+				Positional: []string{"=x", "--=y", "1a=b"},
+				Options:    map[string]string{},
+			},
+		},
+		{
+			pattern: `/run`,
+			comment: "no command here",
+			want: &CommandArgs{
+				Captures:   map[string]string{},
+				Positional: []string{},
+				Options:    map[string]string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseCommandArgs(regexp.MustCompile(tt.pattern), tt.comment)
+		if err != nil {
+			t.Errorf("ParseCommandArgs(%q, %q) error = %v", tt.pattern, tt.comment, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCommandArgs(%q, %q) = %+v, want %+v", tt.pattern, tt.comment, got, tt.want)
+		}
+	}
+
+	if _, err := ParseCommandArgs(regexp.MustCompile(`/run`), `/run "open`); err == nil {
+		t.Errorf("ParseCommandArgs with an unterminated quote succeeded")
+	}
+}
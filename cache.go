@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache is a key-value cache persisted in the check container between check
+// runs. Entries expire after the TTL; with a TTL of 0 the cache only lasts for
+// the current run.
+type Cache struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// CachePath returns the cache file of a source in the temporary directory.
+// It is keyed by the access token so that sources authenticated as
+// different users never share answers.
+func CachePath(source *Source) string {
+	sum := sha256.Sum256([]byte(source.AccessToken + "\x00" + source.Repository))
+	return filepath.Join(os.TempDir(), "github-pr-comment-hook-resource", fmt.Sprintf("%x.json", sum[:8]))
+}
+
+// LoadCache loads the unexpired entries of the cache file at path. A missing
+// or broken cache file gives an empty cache.
+func LoadCache(path string, ttl time.Duration) *Cache {
+	cache := &Cache{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+	if ttl <= 0 {
+		return cache
+	}
+	bin, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var entries map[string]cacheEntry
+	if err := json.Unmarshal(bin, &entries); err != nil {
+		return cache
+	}
+	now := time.Now()
+	for key, entry := range entries {
+		if entry.ExpiresAt.After(now) {
+			cache.entries[key] = entry
+		}
+	}
+	return cache
+}
+
+// Get decodes the entry of key into v and reports whether it was found.
+func (cache *Cache) Get(key string, v interface{}) bool {
+	entry, ok := cache.entries[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(entry.Value, v) == nil
+}
+
+func (cache *Cache) Set(key string, v interface{}) {
+	bin, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	cache.entries[key] = cacheEntry{
+		Value:     bin,
+		ExpiresAt: time.Now().Add(cache.ttl),
+	}
+}
+
+// Save writes the cache file unless the TTL is 0.
+func (cache *Cache) Save() error {
+	if cache.ttl <= 0 {
+		return nil
+	}
+	bin, err := json.Marshal(cache.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache: %s", err.Error())
+	}
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %s", err.Error())
+	}
+	tmp := cache.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, bin, 0600); err != nil {
+		return fmt.Errorf("failed to write cache file: %s", err.Error())
+	}
+	return os.Rename(tmp, cache.path)
+}
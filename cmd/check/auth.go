@@ -0,0 +1,400 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
+	"github.com/google/go-github/v29/github"
+)
+
+// command is a resource.Command ready to be matched against triggers.
+type command struct {
+	name       string
+	pattern    *regexp.Regexp
+	authorizer *authorizer
+	// confirm is the confirm_pattern of a command requiring confirmation.
+	confirm       *regexp.Regexp
+	confirmWithin time.Duration
+}
+
+// authorizer decides whether a user may trigger a command. Team and
+// organization memberships are only looked up for the users who commented.
+type authorizer struct {
+	lookup *userLookup
+	auth   resource.Authorization
+}
+
+// userLookup caches what check looks up about users. Memberships are kept in
+// the on-disk cache; permissions, changed files and CODEOWNERS for the check
+// run.
+type userLookup struct {
+	client      *resource.GithubClient
+	lister      resource.PullRequestLister
+	allowSelf   bool
+	self        *string
+	cache       *resource.Cache
+	permissions map[string]string
+	teams       map[resource.Team]bool
+	files       map[int][]string
+	codeOwners  map[string]*resource.CodeOwners
+}
+
+func newUserLookup(client *resource.GithubClient, lister resource.PullRequestLister, source *resource.Source, cache *resource.Cache) *userLookup {
+	return &userLookup{
+		client:      client,
+		lister:      lister,
+		allowSelf:   source.AllowSelf,
+		cache:       cache,
+		permissions: make(map[string]string),
+		teams:       make(map[resource.Team]bool),
+		files:       make(map[int][]string),
+		codeOwners:  make(map[string]*resource.CodeOwners),
+	}
+}
+
+// newCommands returns the commands of source. The first one is the unnamed
+// command for trigger_reactions and trigger_events with the source
+// authorization, whose pattern is trigger_phrase if set.
+func newCommands(source *resource.Source, lookup *userLookup) ([]*command, error) {
+	commands := []*command{{authorizer: newAuthorizer(lookup, &source.Authorization)}}
+	for _, cmd := range source.GetCommands() {
+		pattern, err := source.CompilePattern(cmd.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		if cmd.Name == "" {
+			commands[0].pattern = pattern
+			continue
+		}
+		c := &command{
+			name:       cmd.Name,
+			pattern:    pattern,
+			authorizer: newAuthorizer(lookup, &cmd.Authorization),
+		}
+		if cmd.ConfirmPattern != "" {
+			c.confirm, err = source.CompilePattern(cmd.ConfirmPattern)
+			if err != nil {
+				return nil, err
+			}
+			c.confirmWithin, err = cmd.GetConfirmWithin()
+			if err != nil {
+				return nil, err
+			}
+		}
+		commands = append(commands, c)
+	}
+	return commands, nil
+}
+
+// matchCommands returns the commands a trigger invokes and its user is
+// allowed to run. Commands requiring confirmation are left to
+// listConfirmations.
+func matchCommands(commands []*command, trigger *trigger) ([]*command, error) {
+	switch trigger.kind {
+	case resource.KindReaction, resource.KindEvent:
+		// trigger_reactions、trigger_eventsに一致するものだけ収集している
+		ok, err := commands[0].authorizer.allowed(trigger)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return commands[:1], nil
+	}
+
+	// outが投稿したコメントはトリガーにしない
+	if strings.Contains(trigger.body, resource.CommentMarker) {
+		return nil, nil
+	}
+	body := resource.NormalizeComment(trigger.body)
+	var matched []*command
+	for _, cmd := range commands {
+		if cmd.pattern == nil || cmd.confirm != nil || !cmd.pattern.MatchString(body) {
+			continue
+		}
+		ok, err := cmd.authorizer.allowed(trigger)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, cmd)
+		}
+	}
+	return matched, nil
+}
+
+func newAuthorizer(lookup *userLookup, auth *resource.Authorization) *authorizer {
+	return &authorizer{
+		lookup: lookup,
+		auth:   *auth,
+	}
+}
+
+// allowed reports whether the user of a trigger is allowed and not ignored.
+func (authorizer *authorizer) allowed(trigger *trigger) (bool, error) {
+	login := trigger.user.GetLogin()
+	auth := &authorizer.auth
+	// fmt.Fprintf(os.Stderr, "CommentUser '%s' (%s)\n", login, trigger.association)
+	// 削除されたユーザーはGraphQLで空のloginになり、組織メンバーの一覧やallow_usersの*に一致してしまう
+	if login == "" {
+		return false, nil
+	}
+	if auth.IgnoreBots && trigger.user.GetType() == "Bot" {
+		return false, nil
+	}
+	if !authorizer.lookup.allowSelf && login == authorizer.lookup.getSelf() {
+		return false, nil
+	}
+	ignored, err := authorizer.lookup.isListed(login, auth.IgnoreUsers, auth.IgnoreTeams, auth.IgnoreOrgs)
+	if err != nil || ignored {
+		return false, err
+	}
+	if len(auth.IgnoreAssociations) != 0 {
+		if trigger.association == "" {
+			fmt.Fprintf(os.Stderr, "%s of %s has no author association, ignored by ignore_associations\n", trigger.kind, login)
+			return false, nil
+		}
+		if resource.HasAssociation(auth.IgnoreAssociations, trigger.association) {
+			return false, nil
+		}
+	}
+	if auth.AllowAllUsers {
+		return true, nil
+	}
+	if trigger.association != "" && resource.HasAssociation(auth.AllowAssociations, trigger.association) {
+		return true, nil
+	}
+	allowed, err := authorizer.lookup.isListed(login, auth.AllowUsers, auth.AllowTeams, auth.AllowOrgs)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	if auth.CodeOwners != "" && trigger.pull != nil {
+		owner, err := authorizer.lookup.isCodeOwner(trigger.pull, login, auth.CodeOwners == resource.CodeOwnersAll)
+		if err != nil || owner {
+			return owner, err
+		}
+	}
+	if auth.MinPermission != "" {
+		permission, err := authorizer.lookup.getPermission(login)
+		if err != nil {
+			return false, err
+		}
+		if resource.HasPermission(permission, auth.MinPermission) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isListed reports whether login matches one of users or is a member of one
+// of teams or orgs.
+func (lookup *userLookup) isListed(login string, users []string, teams []resource.Team, orgs []string) (bool, error) {
+	if resource.MatchPatterns(users, login, true) {
+		return true, nil
+	}
+	for _, team := range teams {
+		member, err := lookup.isTeamMember(team, login)
+		if err != nil || member {
+			return member, err
+		}
+	}
+	for _, org := range orgs {
+		member, err := lookup.isOrgMember(org, login)
+		if err != nil || member {
+			return member, err
+		}
+	}
+	return false, nil
+}
+
+// isTeamMember reports whether login is a member of a team. GitHub counts
+// the members of child teams as members.
+func (lookup *userLookup) isTeamMember(team resource.Team, login string) (bool, error) {
+	key := fmt.Sprintf("team:%s/%s:%s", team.Organization, team.Slug, login)
+	var member bool
+	if lookup.cache.Get(key, &member) {
+		return member, nil
+	}
+	if err := lookup.resolveTeam(team); err != nil {
+		return false, err
+	}
+	member, err := lookup.client.IsTeamMember(team.Organization, team.Slug, login)
+	if err != nil {
+		return false, fmt.Errorf("failed to get team %s/%s membership of %s: %s", team.Organization, team.Slug, login, err.Error())
+	}
+	lookup.cache.Set(key, member)
+	return member, nil
+}
+
+// resolveTeam checks once per check run that a team exists and is visible to
+// the access token. Otherwise every membership lookup would be a 404 and the
+// team would silently match nobody.
+func (lookup *userLookup) resolveTeam(team resource.Team) error {
+	if lookup.teams[team] {
+		return nil
+	}
+	if _, err := lookup.client.GetTeam(team.Organization, team.Slug); err != nil {
+		return fmt.Errorf("failed to get team %s/%s: %s", team.Organization, team.Slug, err.Error())
+	}
+	lookup.teams[team] = true
+	return nil
+}
+
+// getSelf returns the login of the user behind the access token, or an empty
+// string if it cannot be resolved, e.g. for GitHub App tokens.
+func (lookup *userLookup) getSelf() string {
+	if lookup.self != nil {
+		return *lookup.self
+	}
+	var self string
+	if !lookup.cache.Get("self", &self) {
+		var err error
+		self, err = lookup.client.GetAuthenticatedLogin()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get authenticated user, its comments are not ignored: %s\n", err.Error())
+		} else {
+			lookup.cache.Set("self", self)
+		}
+	}
+	lookup.self = &self
+	return self
+}
+
+func (lookup *userLookup) isOrgMember(org string, login string) (bool, error) {
+	key := fmt.Sprintf("org:%s:%s", org, login)
+	var member bool
+	if lookup.cache.Get(key, &member) {
+		return member, nil
+	}
+	member, err := lookup.client.IsOrganizationMember(org, login)
+	if err != nil {
+		return false, fmt.Errorf("failed to get organization %s membership of %s: %s", org, login, err.Error())
+	}
+	lookup.cache.Set(key, member)
+	return member, nil
+}
+
+// getPermission returns the permission of a user on the repository.
+func (lookup *userLookup) getPermission(login string) (string, error) {
+	if permission, ok := lookup.permissions[login]; ok {
+		return permission, nil
+	}
+	permission, err := lookup.client.GetPermissionLevel(login)
+	if err != nil {
+		return "", fmt.Errorf("failed to get permission of %s: %s", login, err.Error())
+	}
+	lookup.permissions[login] = permission
+	return permission, nil
+}
+
+// isCodeOwner reports whether login owns any or, with all, every file the
+// pull request changes that has code owners.
+func (lookup *userLookup) isCodeOwner(pull *github.PullRequest, login string, all bool) (bool, error) {
+	codeOwners, err := lookup.getCodeOwners(pull.GetBase().GetRef())
+	if err != nil {
+		return false, err
+	}
+	files, err := lookup.getFiles(pull.GetNumber())
+	if err != nil {
+		return false, err
+	}
+	owned := false
+	for _, file := range files {
+		owners := codeOwners.Owners(file)
+		if len(owners) == 0 {
+			continue
+		}
+		owner, err := lookup.isOwner(owners, login)
+		if err != nil {
+			return false, err
+		}
+		if owner != all {
+			return owner, nil
+		}
+		owned = owner
+	}
+	return owned, nil
+}
+
+// isOwner reports whether login is one of the @user or @org/team owners.
+// Owners given by email cannot be resolved to users and never match.
+func (lookup *userLookup) isOwner(owners []string, login string) (bool, error) {
+	for _, owner := range owners {
+		if !strings.HasPrefix(owner, "@") {
+			continue
+		}
+		name := owner[1:]
+		slash := strings.Index(name, "/")
+		if slash < 0 {
+			if strings.EqualFold(name, login) {
+				return true, nil
+			}
+			continue
+		}
+		members, err := lookup.getTeamMembers(name[:slash], name[slash+1:])
+		if err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			if strings.EqualFold(member, login) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// getTeamMembers returns the logins of the members of a team.
+func (lookup *userLookup) getTeamMembers(org string, slug string) ([]string, error) {
+	key := fmt.Sprintf("members:%s/%s", org, slug)
+	var logins []string
+	if lookup.cache.Get(key, &logins) {
+		return logins, nil
+	}
+	members, err := lookup.lister.GetTeamMembers(org, slug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of team %s/%s: %s", org, slug, err.Error())
+	}
+	logins = []string{}
+	for _, member := range members {
+		logins = append(logins, member.GetLogin())
+	}
+	lookup.cache.Set(key, logins)
+	return logins, nil
+}
+
+// getCodeOwners returns the CODEOWNERS of a branch, empty if it has none.
+func (lookup *userLookup) getCodeOwners(ref string) (*resource.CodeOwners, error) {
+	if codeOwners, ok := lookup.codeOwners[ref]; ok {
+		return codeOwners, nil
+	}
+	codeOwners := resource.ParseCodeOwners("")
+	for _, path := range resource.CodeOwnersPaths {
+		content, err := lookup.client.GetFileContent(path, ref)
+		if resource.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s of %s: %s", path, ref, err.Error())
+		}
+		codeOwners = resource.ParseCodeOwners(content)
+		break
+	}
+	lookup.codeOwners[ref] = codeOwners
+	return codeOwners, nil
+}
+
+// getFiles returns the files a pull request changes.
+func (lookup *userLookup) getFiles(number int) ([]string, error) {
+	if files, ok := lookup.files[number]; ok {
+		return files, nil
+	}
+	files, err := lookup.client.GetListPullRequestFiles(number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get files of PR #%d: %s", number, err.Error())
+	}
+	lookup.files[number] = files
+	return files, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
+)
+
+// confirmation is a comment invoking a command that requires confirmation.
+type confirmation struct {
+	command *command
+	request *trigger
+}
+
+// listConfirmations returns the confirmed requests of a pull request keyed by
+// the confirming trigger. Requests older than the last version are included
+// so that a later confirmation still finds them, and each request is
+// confirmed only by the first matching comment so it triggers one version.
+func listConfirmations(commands []*command, triggers []*trigger) (map[*trigger][]*confirmation, error) {
+	confirmations := make(map[*trigger][]*confirmation)
+	sorted := append([]*trigger{}, triggers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].createdAt.Before(sorted[j].createdAt)
+	})
+
+	var pending []*confirmation
+	for _, trg := range sorted {
+		if trg.kind == resource.KindReaction || trg.kind == resource.KindEvent {
+			continue
+		}
+		if strings.Contains(trg.body, resource.CommentMarker) {
+			continue
+		}
+		body := resource.NormalizeComment(trg.body)
+
+		remaining := pending[:0]
+		for _, c := range pending {
+			if trg.createdAt.Sub(c.request.createdAt) > c.command.confirmWithin {
+				continue
+			}
+			ok, err := c.confirmedBy(trg, body)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				confirmations[trg] = append(confirmations[trg], c)
+				continue
+			}
+			remaining = append(remaining, c)
+		}
+		pending = remaining
+
+		for _, cmd := range commands {
+			if cmd.confirm == nil || !cmd.pattern.MatchString(body) {
+				continue
+			}
+			ok, err := cmd.authorizer.allowed(trg)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				pending = append(pending, &confirmation{command: cmd, request: trg})
+			}
+		}
+	}
+	return confirmations, nil
+}
+
+// confirmedBy reports whether a trigger confirms the request: it matches the
+// confirm_pattern and was posted by another user allowed to run the command
+// after the request was last edited, so that the requester cannot replace
+// the confirmed request.
+func (c *confirmation) confirmedBy(trigger *trigger, body string) (bool, error) {
+	if !c.command.confirm.MatchString(body) {
+		return false, nil
+	}
+	if c.request.updatedAt.After(trigger.createdAt) {
+		return false, nil
+	}
+	if strings.EqualFold(trigger.user.GetLogin(), c.request.user.GetLogin()) {
+		return false, nil
+	}
+	return c.command.authorizer.allowed(trigger)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
+	"github.com/google/go-github/v29/github"
+)
+
+func TestListConfirmations(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	comment := func(id int64, login string, body string, minute int) *trigger {
+		createdAt := t0.Add(time.Duration(minute) * time.Minute)
+		return &trigger{
+			kind:      resource.KindIssueComment,
+			id:        id,
+			user:      &github.User{Login: github.String(login)},
+			body:      body,
+			createdAt: createdAt,
+			updatedAt: createdAt,
+		}
+	}
+	edited := func(trg *trigger, minute int) *trigger {
+		trg.updatedAt = t0.Add(time.Duration(minute) * time.Minute)
+		return trg
+	}
+	cmd := &command{
+		name:          "deploy",
+		pattern:       regexp.MustCompile(`^/deploy`),
+		confirm:       regexp.MustCompile(`^/approve`),
+		confirmWithin: time.Hour,
+		authorizer: &authorizer{
+			lookup: &userLookup{allowSelf: true},
+			auth:   resource.Authorization{AllowUsers: []string{"alice", "bob", "carol"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		triggers []*trigger
+		// want maps the id of each confirming trigger to the ids of the
+		// requests it confirms.
+		want map[int64][]int64
+	}{
+		{
+			name: "confirmed",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "bob", "/approve", 1),
+			},
+			want: map[int64][]int64{2: {1}},
+		},
+		{
+			name: "confirmed out of order",
+			triggers: []*trigger{
+				comment(2, "bob", "/approve", 1),
+				comment(1, "alice", "/deploy", 0),
+			},
+			want: map[int64][]int64{2: {1}},
+		},
+		{
+			name: "self confirmation",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "Alice", "/approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "expired",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "bob", "/approve", 61),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "unauthorized confirmer",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "mallory", "/approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "unauthorized requester",
+			triggers: []*trigger{
+				comment(1, "mallory", "/deploy", 0),
+				comment(2, "bob", "/approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "confirmed twice",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "bob", "/approve", 1),
+				comment(3, "carol", "/approve", 2),
+			},
+			want: map[int64][]int64{2: {1}},
+		},
+		{
+			name: "one confirmation for two requests",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "carol", "/deploy", 1),
+				comment(3, "bob", "/approve", 2),
+			},
+			want: map[int64][]int64{3: {1, 2}},
+		},
+		{
+			name: "marker on request",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy\n"+resource.CommentMarker, 0),
+				comment(2, "bob", "/approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "marker on confirmation",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "bob", "/approve\n"+resource.CommentMarker, 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "quoted confirmation",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				comment(2, "bob", "> /approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "request edited after confirmation",
+			triggers: []*trigger{
+				edited(comment(1, "alice", "/deploy", 0), 2),
+				comment(2, "bob", "/approve", 1),
+			},
+			want: map[int64][]int64{},
+		},
+		{
+			name: "request edited before confirmation",
+			triggers: []*trigger{
+				edited(comment(1, "alice", "/deploy", 0), 1),
+				comment(2, "bob", "/approve", 2),
+			},
+			want: map[int64][]int64{2: {1}},
+		},
+		{
+			name: "reactions",
+			triggers: []*trigger{
+				comment(1, "alice", "/deploy", 0),
+				{kind: resource.KindReaction, id: 2, user: &github.User{Login: github.String("bob")}, body: "/approve", createdAt: t0.Add(time.Minute)},
+			},
+			want: map[int64][]int64{},
+		},
+	}
+	for _, tt := range tests {
+		confirmations, err := listConfirmations([]*command{cmd}, tt.triggers)
+		if err != nil {
+			t.Errorf("%s: listConfirmations error = %v", tt.name, err)
+			continue
+		}
+		got := make(map[int64][]int64)
+		for trg, cs := range confirmations {
+			for _, c := range cs {
+				got[trg.id] = append(got[trg.id], c.request.id)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: listConfirmations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
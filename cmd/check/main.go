@@ -4,11 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"regexp"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
+	"github.com/google/go-github/v29/github"
 )
 
 type Request struct {
@@ -23,7 +24,7 @@ func (r Response) Len() int {
 }
 
 func (r Response) Less(i, j int) bool {
-	return r[i].CommentID < r[j].CommentID
+	return r[i].Less(&r[j])
 }
 
 func (r Response) Swap(i, j int) {
@@ -50,21 +51,17 @@ func main() {
 		return
 	}
 
-	triggerPhrase := regexp.MustCompile(request.Source.TriggerPhrase)
-
 	client, err := resource.CreateGithubClient(&request.Source)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to create github client: %s\n", err.Error())
 		os.Exit(1)
 		return
 	}
-	allowUsers, err := getGithubUsers(client, request.Source.AllowUsers, request.Source.AllowTeams)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
-		return
-	}
-	ignoreUsers, err := getGithubUsers(client, request.Source.IgnoreUsers, request.Source.IgnoreTeams)
+	lister := resource.CreatePullRequestLister(&request.Source, client)
+	cacheTTL, _ := request.Source.GetMembershipCacheTTL()
+	cache := resource.LoadCache(resource.CachePath(&request.Source), cacheTTL)
+	lookup := newUserLookup(client, lister, &request.Source, cache)
+	commands, err := newCommands(&request.Source, lookup)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -73,91 +70,240 @@ func main() {
 
 	response := Response{}
 
-	pullRequests, err := client.GetListPullRequests()
+	cutoff, _ := request.Source.GetCommentCutoff(time.Now())
+	pullRequests, triggers, err := listTriggers(client, lister, &request.Source, &request.Version, cutoff)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get PullRequests: %s\n", err.Error())
+		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 		return
 	}
-	var lastCommentID int64
-	if request.Version.CommentID != "" {
-		lastCommentID, err = request.Version.GetCommentID()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
-			return
-		}
-	} else {
-		lastCommentID = 0
+	// 編集履歴はGraphQLでしか取得できない
+	graphQL, _ := lister.(*resource.GraphQLClient)
+	hasConfirm := false
+	for _, cmd := range commands {
+		hasConfirm = hasConfirm || cmd.confirm != nil
 	}
 	for _, pullRequest := range pullRequests {
 		// infoEncoder.Encode(pullRequest)
-		comments, err := client.GetListIssueComments(pullRequest.GetNumber())
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to get comments: %s\n", err.Error())
-			os.Exit(1)
-			return
+		var reviews []*github.PullRequestReview
+		var headSeenAt *time.Time
+		var touched *bool
+		for _, trigger := range triggers[pullRequest.GetNumber()] {
+			trigger.pull = pullRequest
 		}
-		for _, comment := range comments {
-			if comment.GetID() <= lastCommentID {
-				continue
+		var confirmations map[*trigger][]*confirmation
+		if hasConfirm {
+			confirmations, err = listConfirmations(commands, triggers[pullRequest.GetNumber()])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+				return
 			}
-			commentUser := comment.GetUser().GetLogin()
-			// fmt.Fprintf(os.Stderr, "CommentUser '%s'\n", commentUser)
-			if !request.Source.AllowAllUsers {
-				if _, ok := allowUsers[commentUser]; !ok {
+		}
+		for _, trigger := range triggers[pullRequest.GetNumber()] {
+			version := resource.Version{
+				PR:          strconv.Itoa(pullRequest.GetNumber()),
+				CommentID:   strconv.FormatInt(trigger.id, 10),
+				Comment:     trigger.body,
+				CommentedAt: trigger.createdAt,
+				Kind:        trigger.kind,
+			}
+			if request.Version.CommentID != "" && !request.Version.Less(&version) {
+				// 前回のversion以前のコメントでも、その後に編集されていれば編集時刻で新しいversionとする
+				if !request.Source.TriggerOnEdit || !trigger.edited() {
+					continue
+				}
+				editedAt := trigger.updatedAt
+				version.EditedAt = &editedAt
+				if !request.Version.Less(&version) {
 					continue
 				}
 			}
-			if _, ok := ignoreUsers[commentUser]; ok {
+			if version.TriggeredAt().Before(cutoff) {
 				continue
 			}
-			if triggerPhrase.MatchString(comment.GetBody()) {
-				// infoEncoder.Encode(comment)
-				version := resource.Version{
-					PR:          strconv.Itoa(pullRequest.GetNumber()),
-					Commit:      pullRequest.GetHead().GetSHA(),
-					CommentID:   strconv.FormatInt(comment.GetID(), 10),
-					Comment:     comment.GetBody(),
-					CommentedAt: comment.GetCreatedAt(),
+			matched, err := matchCommands(commands, trigger)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err.Error())
+				os.Exit(1)
+				return
+			}
+			if version.EditedAt != nil {
+				if graphQL == nil {
+					graphQL = resource.NewGraphQLClient(client)
+				}
+				matched, err = newlyMatched(graphQL, trigger, matched)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					os.Exit(1)
+					return
+				}
+			}
+			// 確認コメントを編集しても、確認済みのコマンドを再実行しない
+			var confirmed []*confirmation
+			if version.EditedAt == nil {
+				confirmed = confirmations[trigger]
+			}
+			if len(matched) == 0 && len(confirmed) == 0 {
+				continue
+			}
+			// infoEncoder.Encode(trigger)
+			if touched == nil && request.Source.HasPathFilter() {
+				files, err := lookup.getFiles(pullRequest.GetNumber())
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err.Error())
+					os.Exit(1)
+					return
+				}
+				ok := request.Source.FilterChangedFiles(files)
+				touched = &ok
+			}
+			if touched != nil && !*touched {
+				fmt.Fprintf(os.Stderr, "PR #%d does not change watched paths\n", pullRequest.GetNumber())
+				break
+			}
+			needsHead := (trigger.commit == "" || len(confirmed) != 0) && request.Source.GetOnHeadMoved() != resource.HeadMovedHead
+			needsReviews := needsHead || request.Source.NeedsApprovals(pullRequest)
+			if needsReviews && reviews == nil {
+				reviews, err = client.GetListPullRequestReviews(pullRequest.GetNumber())
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to get reviews: %s\n", err.Error())
+					os.Exit(1)
+					return
+				}
+				if reviews == nil {
+					reviews = []*github.PullRequestReview{}
+				}
+			}
+			if needsHead && headSeenAt == nil {
+				seenAt, err := getHeadSeenAt(client, pullRequest, reviews)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to get head commit: %s\n", err.Error())
+					os.Exit(1)
+					return
 				}
+				headSeenAt = &seenAt
+			}
+
+			if len(matched) != 0 {
+				commit, ok := resolveCommit(&request.Source, pullRequest, headSeenAt, trigger, &version)
+				if ok && approved(&request.Source, pullRequest, reviews, commit) && forkAllowed(&request.Source, pullRequest, reviews, commit) {
+					version.Commit = commit
+					for _, cmd := range matched {
+						version.Command = cmd.name
+						fmt.Fprintf(os.Stderr, "Version:\n")
+						infoEncoder.Encode(version)
+						response = append(response, version)
+					}
+				}
+			}
+			for _, c := range confirmed {
+				// 確認されたコマンドは依頼コメントの時点のコミットをビルドする
+				requested := resource.Version{CommentedAt: c.request.createdAt}
+				commit, ok := resolveCommit(&request.Source, pullRequest, headSeenAt, c.request, &requested)
+				if !ok || !approved(&request.Source, pullRequest, reviews, commit) || !forkAllowed(&request.Source, pullRequest, reviews, commit) {
+					continue
+				}
+				confirmedVersion := version
+				confirmedVersion.Commit = commit
+				confirmedVersion.Comment = c.request.body
+				confirmedVersion.Command = c.command.name
+				confirmedVersion.RequestedBy = c.request.user.GetLogin()
+				confirmedVersion.ConfirmedBy = trigger.user.GetLogin()
 				fmt.Fprintf(os.Stderr, "Version:\n")
-				infoEncoder.Encode(version)
-				response = append(response, version)
+				infoEncoder.Encode(confirmedVersion)
+				response = append(response, confirmedVersion)
 			}
 		}
 	}
 	sort.Sort(response)
 
-	// チェックするコメントがなければversionをそのまま返す
-	if len(response) == 0 && request.Version.CommentID != "" {
-		response = Response{request.Version}
+	if err := cache.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to save cache: %s\n", err.Error())
+	}
+
+	// versionが指定されていれば、そのversionに続けて新しいコメントを古い順に全て返す
+	if request.Version.CommentID != "" {
+		response = append(Response{request.Version}, response...)
 	}
 	// versionが空（一番最初or手動起動時）は最新のバージョンにする
 	if len(response) != 0 && request.Version.CommentID == "" {
 		response = Response{response[len(response)-1]}
 	}
-	if len(response) != 0 {
-		response = Response{response[0]}
-	}
 
 	json.NewEncoder(os.Stdout).Encode(response)
 }
 
-func getGithubUsers(client *resource.GithubClient, users []string, teams []resource.Team) (map[string]struct{}, error) {
-	userMap := make(map[string]struct{}, len(users))
-	for _, user := range users {
-		userMap[user] = struct{}{}
+// approved reports whether commit has the required_approvals of source.
+func approved(source *resource.Source, pullRequest *github.PullRequest, reviews []*github.PullRequestReview, commit string) bool {
+	if source.RequiredApprovals <= 0 {
+		return true
+	}
+	approvals := resource.CountApprovals(reviews, pullRequest.GetUser().GetLogin(), commit)
+	if approvals < source.RequiredApprovals {
+		fmt.Fprintf(os.Stderr, "PR #%d has %d of %d required approvals on %s\n", pullRequest.GetNumber(), approvals, source.RequiredApprovals, commit)
+		return false
+	}
+	return true
+}
+
+// forkAllowed reports whether fork_policy of source lets a pull request build
+// commit.
+func forkAllowed(source *resource.Source, pullRequest *github.PullRequest, reviews []*github.PullRequestReview, commit string) bool {
+	approvals := resource.CountApprovals(reviews, pullRequest.GetUser().GetLogin(), commit)
+	if !source.FilterFork(pullRequest, approvals) {
+		fmt.Fprintf(os.Stderr, "PR #%d from fork %s is not allowed by fork_policy %s\n", pullRequest.GetNumber(), pullRequest.GetHead().GetRepo().GetFullName(), source.GetForkPolicy())
+		return false
 	}
-	for _, team := range teams {
-		users, err := client.GetTeamMembers(team.Organization, team.Slug)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get team %s/%s: %s", team.Organization, team.Slug, err.Error())
+	return true
+}
+
+// getHeadSeenAt returns the earliest time GitHub recorded the head commit of
+// a pull request by a commit status, check suite or review, or the zero time.
+func getHeadSeenAt(client *resource.GithubClient, pullRequest *github.PullRequest, reviews []*github.PullRequestReview) (time.Time, error) {
+	head := pullRequest.GetHead().GetSHA()
+	seenAt, err := client.GetCommitSeenAt(head)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, review := range reviews {
+		if review.GetCommitID() != head || review.GetSubmittedAt().IsZero() {
+			continue
 		}
-		for _, user := range users {
-			name := user.GetLogin()
-			userMap[name] = struct{}{}
+		if seenAt.IsZero() || review.GetSubmittedAt().Before(seenAt) {
+			seenAt = review.GetSubmittedAt()
 		}
 	}
-	return userMap, nil
+	return seenAt, nil
+}
+
+// resolveCommit returns the commit to build for a trigger: the commit a review
+// or review comment was made on, or the head, which on_head_moved reject
+// drops unless GitHub recorded it at or before the time a comment was posted
+// or edited. The second return value is false when the trigger must be
+// dropped.
+func resolveCommit(source *resource.Source, pullRequest *github.PullRequest, headSeenAt *time.Time, trigger *trigger, version *resource.Version) (string, bool) {
+	head := pullRequest.GetHead().GetSHA()
+	if source.GetOnHeadMoved() == resource.HeadMovedHead {
+		return head, true
+	}
+	if trigger.commit != "" {
+		if trigger.commit == head {
+			return head, true
+		}
+		fmt.Fprintf(os.Stderr, "PR #%d head moved after comment at %s: %s -> %s\n", pullRequest.GetNumber(), version.TriggeredAt().Format(time.RFC3339), trigger.commit, head)
+		if source.GetOnHeadMoved() == resource.HeadMovedReject {
+			return "", false
+		}
+		return trigger.commit, true
+	}
+	if headSeenAt != nil && !headSeenAt.IsZero() && !headSeenAt.After(version.TriggeredAt()) {
+		return head, true
+	}
+	if source.GetOnHeadMoved() == resource.HeadMovedReject {
+		fmt.Fprintf(os.Stderr, "PR #%d head %s is not known to GitHub before comment at %s, rejected\n", pullRequest.GetNumber(), head, version.TriggeredAt().Format(time.RFC3339))
+		return "", false
+	}
+	fmt.Fprintf(os.Stderr, "warning: PR #%d head %s is not known to GitHub before comment at %s, it may have moved after the comment\n", pullRequest.GetNumber(), head, version.TriggeredAt().Format(time.RFC3339))
+	return head, true
 }
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
+	"github.com/google/go-github/v29/github"
+)
+
+// trigger is a comment of any kind that may trigger a version.
+type trigger struct {
+	kind string
+	id   int64
+	// nodeID is the GraphQL ID of an editable comment.
+	nodeID string
+	user   *github.User
+	// association is the author_association of a comment or review.
+	association string
+	body        string
+	createdAt   time.Time
+	// updatedAt is the time an editable comment was last updated.
+	updatedAt time.Time
+	// commit is the commit a review was made on, empty for issue comments.
+	commit string
+	// pull is the pull request the trigger was posted on, for authorization
+	// by codeowners.
+	pull *github.PullRequest
+}
+
+func issueCommentTrigger(comment *github.IssueComment) *trigger {
+	return &trigger{
+		kind:        resource.KindIssueComment,
+		id:          comment.GetID(),
+		nodeID:      comment.GetNodeID(),
+		user:        comment.GetUser(),
+		association: comment.GetAuthorAssociation(),
+		body:        comment.GetBody(),
+		createdAt:   comment.GetCreatedAt(),
+		updatedAt:   comment.GetUpdatedAt(),
+	}
+}
+
+func reactionTrigger(reaction *resource.Reaction) *trigger {
+	return &trigger{
+		kind:      resource.KindReaction,
+		id:        reaction.ID,
+		user:      reaction.User,
+		body:      reaction.Content,
+		createdAt: reaction.CreatedAt,
+	}
+}
+
+func eventTrigger(event *resource.TimelineEvent) *trigger {
+	return &trigger{
+		kind:      resource.KindEvent,
+		id:        event.ID,
+		user:      event.Actor,
+		body:      event.Describe(),
+		createdAt: event.CreatedAt,
+	}
+}
+
+func reviewTrigger(review *github.PullRequestReview) *trigger {
+	return &trigger{
+		kind:        resource.KindReview,
+		id:          review.GetID(),
+		user:        review.GetUser(),
+		association: review.GetAuthorAssociation(),
+		body:        review.GetBody(),
+		createdAt:   review.GetSubmittedAt(),
+		commit:      review.GetCommitID(),
+	}
+}
+
+// reviewCommentTrigger uses the commit a review comment was written on. Its
+// commit_id moves to later commits while the comment still applies.
+func reviewCommentTrigger(comment *github.PullRequestComment) *trigger {
+	return &trigger{
+		kind:        resource.KindReviewComment,
+		id:          comment.GetID(),
+		nodeID:      comment.GetNodeID(),
+		user:        comment.GetUser(),
+		association: comment.GetAuthorAssociation(),
+		body:        comment.GetBody(),
+		createdAt:   comment.GetCreatedAt(),
+		updatedAt:   comment.GetUpdatedAt(),
+		commit:      comment.GetOriginalCommitID(),
+	}
+}
+
+// edited reports whether the comment was edited after it was posted.
+func (trigger *trigger) edited() bool {
+	return trigger.updatedAt.After(trigger.createdAt)
+}
+
+// newlyMatched returns the commands of matched that no earlier revision of an
+// edited comment matched, so that editing a comment which may already have
+// triggered a version does not trigger it again. Without a readable edit
+// history none of them is returned.
+func newlyMatched(graphQL *resource.GraphQLClient, trigger *trigger, matched []*command) ([]*command, error) {
+	if len(matched) == 0 || trigger.nodeID == "" {
+		return nil, nil
+	}
+	revisions, err := graphQL.GetListCommentRevisions(trigger.nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get edit history of comment %d: %s", trigger.id, err.Error())
+	}
+	var previous []string
+	for _, revision := range revisions {
+		if revision == nil {
+			// 削除された版は一致していたか分からない
+			return nil, nil
+		}
+		if *revision != trigger.body {
+			previous = append(previous, resource.NormalizeComment(*revision))
+		}
+	}
+	if len(previous) == 0 {
+		return nil, nil
+	}
+	var commands []*command
+	for _, cmd := range matched {
+		newly := true
+		for _, body := range previous {
+			if cmd.pattern != nil && cmd.pattern.MatchString(body) {
+				newly = false
+				break
+			}
+		}
+		if newly {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands, nil
+}
+
+// listTriggers returns the pull requests to check and the comments that
+// may trigger them keyed by pull request number.
+func listTriggers(client *resource.GithubClient, lister resource.PullRequestLister, source *resource.Source, version *resource.Version, cutoff time.Time) ([]*github.PullRequest, map[int][]*trigger, error) {
+	if source.GetPollStrategy() == resource.PollRepository {
+		since := version.TriggeredAt()
+		if cutoff.After(since) {
+			since = cutoff
+		}
+		return listRepositoryTriggers(client, source, since)
+	}
+
+	triggers := make(map[int][]*trigger)
+	var listed []*github.PullRequest
+	if source.HasState(resource.PullRequestOpen) {
+		pulls, err := lister.GetListPullRequests()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get PullRequests: %s", err.Error())
+		}
+		listed = append(listed, pulls...)
+	}
+	if source.HasState(resource.PullRequestClosed) || source.HasState(resource.PullRequestMerged) {
+		maxAge, _ := source.GetClosedMaxAge()
+		pulls, err := lister.GetListClosedPullRequests(time.Now().Add(-maxAge))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get closed PullRequests: %s", err.Error())
+		}
+		listed = append(listed, pulls...)
+	}
+	var pullRequests []*github.PullRequest
+	for _, pullRequest := range listed {
+		if !source.FilterPullRequest(pullRequest) {
+			continue
+		}
+		pullRequests = append(pullRequests, pullRequest)
+	}
+	for _, pullRequest := range pullRequests {
+		number := pullRequest.GetNumber()
+		comments, err := lister.GetListIssueComments(number)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get comments: %s", err.Error())
+		}
+		for _, comment := range comments {
+			triggers[number] = append(triggers[number], issueCommentTrigger(comment))
+		}
+		if len(source.TriggerReactions) != 0 {
+			trgs, err := listReactionTriggers(client, source, number, comments)
+			if err != nil {
+				return nil, nil, err
+			}
+			triggers[number] = append(triggers[number], trgs...)
+		}
+		if len(source.TriggerEvents) != 0 {
+			events, err := client.GetListIssueTimeline(number)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get timeline: %s", err.Error())
+			}
+			for _, event := range events {
+				for _, selector := range source.TriggerEvents {
+					if selector.Match(event) {
+						triggers[number] = append(triggers[number], eventTrigger(event))
+						break
+					}
+				}
+			}
+		}
+		if source.TriggerOnReviews {
+			reviews, err := client.GetListPullRequestReviews(number)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get reviews: %s", err.Error())
+			}
+			for _, review := range reviews {
+				// 下書き中のレビューは投稿されていない
+				if review.GetState() == "PENDING" {
+					continue
+				}
+				triggers[number] = append(triggers[number], reviewTrigger(review))
+			}
+		}
+		if source.TriggerOnReviewComments {
+			comments, err := client.GetListPullRequestComments(number, time.Time{})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get review comments: %s", err.Error())
+			}
+			for _, comment := range comments {
+				triggers[number] = append(triggers[number], reviewCommentTrigger(comment))
+			}
+		}
+	}
+	return pullRequests, triggers, nil
+}
+
+// listReactionTriggers returns the trigger_reactions on the description and
+// comments of a pull request.
+func listReactionTriggers(client *resource.GithubClient, source *resource.Source, number int, comments []*github.IssueComment) ([]*trigger, error) {
+	var reactions []*resource.Reaction
+	for _, target := range source.GetReactionTargets() {
+		switch target {
+		case resource.ReactionTargetBody:
+			rcts, err := client.GetListIssueReactions(number)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get reactions: %s", err.Error())
+			}
+			reactions = append(reactions, rcts...)
+		case resource.ReactionTargetComments:
+			for _, comment := range comments {
+				// リアクションのないコメントは問い合わせない
+				if comment.Reactions != nil && comment.Reactions.GetTotalCount() == 0 {
+					continue
+				}
+				rcts, err := client.GetListIssueCommentReactions(comment.GetID())
+				if err != nil {
+					return nil, fmt.Errorf("failed to get comment reactions: %s", err.Error())
+				}
+				reactions = append(reactions, rcts...)
+			}
+		}
+	}
+
+	var triggers []*trigger
+	for _, reaction := range reactions {
+		if source.IsTriggerReaction(reaction.Content) {
+			triggers = append(triggers, reactionTrigger(reaction))
+		}
+	}
+	return triggers, nil
+}
+
+// listRepositoryTriggers lists the repository-wide comments updated since the
+// last version or the comment cutoff and looks up only the pull requests they
+// belong to.
+func listRepositoryTriggers(client *resource.GithubClient, source *resource.Source, since time.Time) ([]*github.PullRequest, map[int][]*trigger, error) {
+	triggers := make(map[int][]*trigger)
+
+	comments, err := client.GetListRepositoryIssueComments(since)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get comments: %s", err.Error())
+	}
+	for _, comment := range comments {
+		number, err := resource.GetNumberFromURL(comment.GetIssueURL())
+		if err != nil {
+			return nil, nil, err
+		}
+		triggers[number] = append(triggers[number], issueCommentTrigger(comment))
+	}
+	if source.TriggerOnReviewComments {
+		comments, err := client.GetListPullRequestComments(0, since)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get review comments: %s", err.Error())
+		}
+		for _, comment := range comments {
+			number, err := resource.GetNumberFromURL(comment.GetPullRequestURL())
+			if err != nil {
+				return nil, nil, err
+			}
+			triggers[number] = append(triggers[number], reviewCommentTrigger(comment))
+		}
+	}
+
+	var pullRequests []*github.PullRequest
+	for number, trgs := range triggers {
+		// 前回のversionより前に投稿されて更新されただけのコメントしかなければPRを取得しない
+		updated := false
+		for _, trg := range trgs {
+			if !trg.createdAt.Before(since) || (source.TriggerOnEdit && trg.edited()) {
+				updated = true
+				break
+			}
+		}
+		if !updated {
+			delete(triggers, number)
+			continue
+		}
+		pullRequest, err := client.GetPullRequest(number)
+		if resource.IsNotFound(err) {
+			// pull requestではないissueへのコメント
+			delete(triggers, number)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get PullRequest #%d: %s", number, err.Error())
+		}
+		if !source.FilterPullRequest(pullRequest) {
+			delete(triggers, number)
+			continue
+		}
+		pullRequests = append(pullRequests, pullRequest)
+	}
+	return pullRequests, triggers, nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/ajapon88/concourse-github-pr-comment-hook-resource"
 	"github.com/google/go-github/v29/github"
@@ -72,6 +73,27 @@ func main() {
 		return
 	}
 	pull, err := client.GetPullRequest(prNumber)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to get pull request: %s\n", err.Error())
+		os.Exit(1)
+		return
+	}
+	approvals := -1
+	if request.Source.NeedsApprovals(pull) {
+		reviews, err := client.GetListPullRequestReviews(prNumber)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get reviews: %s\n", err.Error())
+			os.Exit(1)
+			return
+		}
+		approvals = resource.CountApprovals(reviews, pull.GetUser().GetLogin(), request.Version.Commit)
+	}
+	// 手動で指定されたversionでもforkのコードを取得しない
+	if !request.Source.FilterFork(pull, approvals) {
+		fmt.Fprintf(os.Stderr, "PR #%d from fork %s is not allowed by fork_policy %s\n", pull.GetNumber(), pull.GetHead().GetRepo().GetFullName(), request.Source.GetForkPolicy())
+		os.Exit(1)
+		return
+	}
 
 	if !request.Params.SkipDownload {
 		if err := gitDownload(dest, &request, pull); err != nil {
@@ -89,9 +111,23 @@ func main() {
 		&resource.MetadataField{Name: "url", Value: pull.GetHTMLURL()},
 		&resource.MetadataField{Name: "head_name", Value: pull.GetHead().GetRef()},
 		&resource.MetadataField{Name: "head_sha", Value: request.Version.Commit},
+		&resource.MetadataField{Name: "head_repo", Value: pull.GetHead().GetRepo().GetFullName()},
+		&resource.MetadataField{Name: "is_fork", Value: strconv.FormatBool(resource.IsFork(pull))},
+		&resource.MetadataField{Name: "head_moved", Value: strconv.FormatBool(request.Version.Commit != pull.GetHead().GetSHA())},
 		&resource.MetadataField{Name: "base_name", Value: pull.GetBase().GetRef()},
 		&resource.MetadataField{Name: "base_sha", Value: pull.GetBase().GetSHA()},
+		&resource.MetadataField{Name: "state", Value: resource.GetPullRequestState(pull)},
+		&resource.MetadataField{Name: "merged", Value: strconv.FormatBool(pull.GetMerged())},
 		&resource.MetadataField{Name: "comment", Value: request.Version.Comment},
+		&resource.MetadataField{Name: "comment_kind", Value: request.Version.GetKind()},
+		&resource.MetadataField{Name: "command", Value: request.Version.Command},
+		&resource.MetadataField{Name: "requested_by", Value: request.Version.RequestedBy},
+		&resource.MetadataField{Name: "confirmed_by", Value: request.Version.ConfirmedBy},
+		&resource.MetadataField{Name: "triggered_at", Value: request.Version.TriggeredAt().Format(time.RFC3339)},
+	}
+
+	if approvals >= 0 {
+		metadata = append(metadata, &resource.MetadataField{Name: "approvals", Value: strconv.Itoa(approvals)})
 	}
 
 	resourceDir := filepath.Join(dest, ".git", "resource")
@@ -121,6 +157,11 @@ func main() {
 			return
 		}
 	}
+	if err := saveArgs(resourceDir, &request); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+		return
+	}
 
 	os.Stdout = stdout
 	response := Response{
@@ -141,6 +182,54 @@ func saveJSON(path string, v interface{}) error {
 	return nil
 }
 
+// saveArgs writes the arguments of the triggering command to args.json and
+// to one file per argument in the args directory: named capture groups and
+// options by name, positional arguments by index.
+func saveArgs(resourceDir string, request *Request) error {
+	args := &resource.CommandArgs{
+		Captures:   map[string]string{},
+		Positional: []string{},
+		Options:    map[string]string{},
+	}
+	kind := request.Version.GetKind()
+	if kind != resource.KindReaction && kind != resource.KindEvent {
+		if command, ok := request.Source.GetCommand(request.Version.Command); ok {
+			pattern, err := request.Source.CompilePattern(command.Pattern)
+			if err != nil {
+				return err
+			}
+			args, err = resource.ParseCommandArgs(pattern, resource.NormalizeComment(request.Version.Comment))
+			if err != nil {
+				return fmt.Errorf("failed to parse command args: %s", err.Error())
+			}
+		}
+	}
+	if err := saveJSON(filepath.Join(resourceDir, "args.json"), args); err != nil {
+		return fmt.Errorf("failed to save args file: %s", err.Error())
+	}
+
+	argsDir := filepath.Join(resourceDir, "args")
+	if err := os.MkdirAll(argsDir, 0777); err != nil {
+		return fmt.Errorf("failed to create args directory: %s", err.Error())
+	}
+	files := make(map[string]string)
+	for name, value := range args.Captures {
+		files[name] = value
+	}
+	for key, value := range args.Options {
+		files[key] = value
+	}
+	for i, value := range args.Positional {
+		files[strconv.Itoa(i)] = value
+	}
+	for name, value := range files {
+		if err := ioutil.WriteFile(filepath.Join(argsDir, name), []byte(value), 0644); err != nil {
+			return fmt.Errorf("failed to write args file: %s", err.Error())
+		}
+	}
+	return nil
+}
+
 func gitDownload(dest string, request *Request, pull *github.PullRequest) error {
 	// TODO: ssh
 	auth := http.BasicAuth{
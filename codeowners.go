@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeOwnersPaths are the locations GitHub reads a CODEOWNERS file from, in
+// order of precedence.
+var CodeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners is a parsed CODEOWNERS file.
+type CodeOwners struct {
+	rules []codeOwnersRule
+}
+
+type codeOwnersRule struct {
+	re     *regexp.Regexp
+	owners []string
+}
+
+// ParseCodeOwners parses a CODEOWNERS file. Lines with invalid patterns are
+// skipped, as GitHub does.
+func ParseCodeOwners(content string) *CodeOwners {
+	codeOwners := &CodeOwners{}
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(codeOwnersToRegexp(fields[0]))
+		if err != nil {
+			continue
+		}
+		codeOwners.rules = append(codeOwners.rules, codeOwnersRule{
+			re:     re,
+			owners: fields[1:],
+		})
+	}
+	return codeOwners
+}
+
+// Owners returns the owners of a file: `@user`, `@org/team` or email
+// entries of the last matching line. A matching line without owners leaves
+// the file unowned.
+func (codeOwners *CodeOwners) Owners(file string) []string {
+	for i := len(codeOwners.rules) - 1; i >= 0; i-- {
+		if codeOwners.rules[i].re.MatchString(file) {
+			return codeOwners.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// codeOwnersToRegexp converts a CODEOWNERS pattern, which follows the
+// gitignore rules, to a regular expression. Patterns without a slash but at
+// the end match at any depth, and patterns matching a directory match the
+// files under it.
+func codeOwnersToRegexp(pattern string) string {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasPrefix(pattern, "**/") {
+		pattern = pattern[len("**/"):]
+		anchored = false
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	prefix := "^"
+	if !anchored {
+		prefix = "^(?:.*/)?"
+	}
+	// dir/* matches the files directly in dir only
+	if strings.HasSuffix(pattern, "/*") {
+		return prefix + globToRegexp(pattern) + "$"
+	}
+	return prefix + globToRegexp(pattern) + "(?:/.*)?$"
+}
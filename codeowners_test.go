@@ -0,0 +1,50 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCodeOwners(t *testing.T) {
+	codeOwners := ParseCodeOwners(`# comment
+*                @global
+*.go             @gopher @org/go-team # trailing comment
+/docs/           @docs
+docs/*           @docs-direct
+build/
+**/logs          @logs
+/src/**/test.txt @tests
+apps/            @apps
+/[bad            @bad
+`)
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{file: "README.md", want: []string{"@global"}},
+		{file: "cmd/main.go", want: []string{"@gopher", "@org/go-team"}},
+		{file: "docs/index.md", want: []string{"@docs-direct"}},
+		{file: "docs/guide/index.md", want: []string{"@docs"}},
+		{file: "x/docs/index.md", want: []string{"@global"}},
+		{file: "build/main.go", want: []string{}},
+		{file: "logs", want: []string{"@logs"}},
+		{file: "a/b/logs/c.txt", want: []string{"@logs"}},
+		{file: "src/test.txt", want: []string{"@tests"}},
+		{file: "src/a/b/test.txt", want: []string{"@tests"}},
+		{file: "apps/web/main.js", want: []string{"@apps"}},
+		{file: "x/apps/main.js", want: []string{"@apps"}},
+		{file: "[bad", want: []string{"@bad"}},
+	}
+	for _, tt := range tests {
+		got := codeOwners.Owners(tt.file)
+		if len(got) != len(tt.want) || (len(got) != 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("Owners(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestCodeOwnersEmpty(t *testing.T) {
+	if got := ParseCodeOwners("").Owners("main.go"); got != nil {
+		t.Errorf("Owners of an empty CODEOWNERS = %q, want nil", got)
+	}
+}
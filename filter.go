@@ -0,0 +1,156 @@
+package resource
+
+import (
+	"path"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+// FilterPullRequest reports whether a pull request passes the pull request
+// filters of source: states, closed_max_age, base_branch, head_branch,
+// labels, ignore_labels, ignore_drafts and authors.
+func (source *Source) FilterPullRequest(pull *github.PullRequest) bool {
+	state := GetPullRequestState(pull)
+	if !source.HasState(state) {
+		return false
+	}
+	if state != PullRequestOpen {
+		maxAge, _ := source.GetClosedMaxAge()
+		if pull.GetClosedAt().Before(time.Now().Add(-maxAge)) {
+			return false
+		}
+	}
+	if source.BaseBranch != "" && !MatchPatterns([]string{source.BaseBranch}, pull.GetBase().GetRef(), false) {
+		return false
+	}
+	if source.HeadBranch != "" && !MatchPatterns([]string{source.HeadBranch}, pull.GetHead().GetRef(), false) {
+		return false
+	}
+	if source.IgnoreDrafts && pull.GetDraft() {
+		return false
+	}
+	if len(source.Authors) != 0 && !MatchPatterns(source.Authors, pull.GetUser().GetLogin(), true) {
+		return false
+	}
+	labels := make(map[string]struct{}, len(pull.Labels))
+	for _, label := range pull.Labels {
+		labels[label.GetName()] = struct{}{}
+	}
+	for _, label := range source.Labels {
+		if _, ok := labels[label]; !ok {
+			return false
+		}
+	}
+	for _, label := range source.IgnoreLabels {
+		if _, ok := labels[label]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPathFilter reports whether paths or ignore_paths is set.
+func (source *Source) HasPathFilter() bool {
+	return len(source.Paths) != 0 || len(source.IgnorePaths) != 0
+}
+
+// FilterChangedFiles reports whether any of the changed files of a pull
+// request matches paths and not ignore_paths.
+func (source *Source) FilterChangedFiles(files []string) bool {
+	for _, file := range files {
+		if len(source.Paths) != 0 && !matchPath(source.Paths, file) {
+			continue
+		}
+		if matchPath(source.IgnorePaths, file) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// matchPath reports whether file or one of its parent directories matches
+// any of patterns.
+func matchPath(patterns []string, file string) bool {
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if MatchPatterns(patterns, p, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalAssociations are the author associations of the reviewers whose
+// approvals count. Anyone can approve a pull request of a public repository.
+var approvalAssociations = []string{"OWNER", "MEMBER", "COLLABORATOR"}
+
+// NeedsApprovals reports whether required_approvals or fork_policy needs the
+// approvals of a pull request.
+func (source *Source) NeedsApprovals(pull *github.PullRequest) bool {
+	return source.RequiredApprovals > 0 || (IsFork(pull) && source.GetForkPolicy() == ForkPolicyRequireApproval)
+}
+
+// CountApprovals returns the number of owners, members and collaborators
+// other than author whose latest review approves commit. Approvals of older
+// commits are stale and do not count. Comment-only reviews do not change the
+// state of a reviewer.
+func CountApprovals(reviews []*github.PullRequestReview, author string, commit string) int {
+	latest := make(map[string]*github.PullRequestReview)
+	for _, review := range reviews {
+		login := review.GetUser().GetLogin()
+		if login == "" || login == author {
+			continue
+		}
+		if !HasAssociation(approvalAssociations, review.GetAuthorAssociation()) {
+			continue
+		}
+		switch review.GetState() {
+		case "APPROVED", "CHANGES_REQUESTED", "DISMISSED":
+		default:
+			continue
+		}
+		if prev, ok := latest[login]; ok && prev.GetSubmittedAt().After(review.GetSubmittedAt()) {
+			continue
+		}
+		latest[login] = review
+	}
+	count := 0
+	for _, review := range latest {
+		if review.GetState() == "APPROVED" && review.GetCommitID() == commit {
+			count++
+		}
+	}
+	return count
+}
+
+// IsFork reports whether the head branch of a pull request is in another
+// repository than its base, including a deleted fork.
+func IsFork(pull *github.PullRequest) bool {
+	head := pull.GetHead().GetRepo()
+	return head == nil || head.GetFullName() != pull.GetBase().GetRepo().GetFullName()
+}
+
+// FilterFork reports whether fork_policy lets a pull request trigger versions
+// given the number of approvals of the commit to build counted by
+// CountApprovals, so that the author cannot approve a fork with a second
+// account that has no access to the repository.
+func (source *Source) FilterFork(pull *github.PullRequest, approvals int) bool {
+	if !IsFork(pull) {
+		return true
+	}
+	switch source.GetForkPolicy() {
+	case ForkPolicyDeny:
+		return false
+	case ForkPolicyRequireLabel:
+		for _, label := range pull.Labels {
+			if label.GetName() == source.ForkTrustedLabel {
+				return true
+			}
+		}
+		return false
+	case ForkPolicyRequireApproval:
+		return approvals > 0
+	}
+	return true
+}
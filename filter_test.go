@@ -0,0 +1,161 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+func review(login string, association string, state string, commit string, minute int) *github.PullRequestReview {
+	submittedAt := time.Date(2020, 1, 1, 0, minute, 0, 0, time.UTC)
+	return &github.PullRequestReview{
+		User:              &github.User{Login: github.String(login)},
+		AuthorAssociation: github.String(association),
+		State:             github.String(state),
+		CommitID:          github.String(commit),
+		SubmittedAt:       &submittedAt,
+	}
+}
+
+func TestCountApprovals(t *testing.T) {
+	tests := []struct {
+		name    string
+		reviews []*github.PullRequestReview
+		want    int
+	}{
+		{
+			name:    "no reviews",
+			reviews: nil,
+			want:    0,
+		},
+		{
+			name: "approvals on the commit",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "head", 1),
+				review("bob", "COLLABORATOR", "APPROVED", "head", 2),
+				review("carol", "OWNER", "APPROVED", "head", 3),
+			},
+			want: 3,
+		},
+		{
+			name: "stale approval on an older commit",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "old", 1),
+			},
+			want: 0,
+		},
+		{
+			name: "approval of the author",
+			reviews: []*github.PullRequestReview{
+				review("author", "MEMBER", "APPROVED", "head", 1),
+			},
+			want: 0,
+		},
+		{
+			name: "changes requested after approval",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "head", 1),
+				review("alice", "MEMBER", "CHANGES_REQUESTED", "head", 2),
+			},
+			want: 0,
+		},
+		{
+			name: "dismissed after approval",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "head", 1),
+				review("alice", "MEMBER", "DISMISSED", "head", 2),
+			},
+			want: 0,
+		},
+		{
+			name: "approval after changes requested",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "CHANGES_REQUESTED", "head", 2),
+				review("alice", "MEMBER", "APPROVED", "head", 3),
+			},
+			want: 1,
+		},
+		{
+			name: "comment after approval",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "head", 1),
+				review("alice", "MEMBER", "COMMENTED", "head", 2),
+				review("alice", "MEMBER", "PENDING", "head", 3),
+			},
+			want: 1,
+		},
+		{
+			name: "approvals counted once per user",
+			reviews: []*github.PullRequestReview{
+				review("alice", "MEMBER", "APPROVED", "head", 1),
+				review("alice", "MEMBER", "APPROVED", "head", 2),
+			},
+			want: 1,
+		},
+		{
+			name: "approvals of non-members",
+			reviews: []*github.PullRequestReview{
+				review("mallory", "NONE", "APPROVED", "head", 1),
+				review("eve", "CONTRIBUTOR", "APPROVED", "head", 2),
+				review("trudy", "FIRST_TIME_CONTRIBUTOR", "APPROVED", "head", 3),
+			},
+			want: 0,
+		},
+		{
+			name: "approval without a user",
+			reviews: []*github.PullRequestReview{
+				review("", "MEMBER", "APPROVED", "head", 1),
+			},
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		if got := CountApprovals(tt.reviews, "author", "head"); got != tt.want {
+			t.Errorf("%s: CountApprovals = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func pullRequest(head string, labels ...string) *github.PullRequest {
+	pull := &github.PullRequest{
+		Base: &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String("owner/repo")}},
+		Head: &github.PullRequestBranch{},
+	}
+	if head != "" {
+		pull.Head.Repo = &github.Repository{FullName: github.String(head)}
+	}
+	for _, label := range labels {
+		pull.Labels = append(pull.Labels, &github.Label{Name: github.String(label)})
+	}
+	return pull
+}
+
+func TestFilterFork(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		pull      *github.PullRequest
+		approvals int
+		want      bool
+	}{
+		{name: "same repository", policy: ForkPolicyDeny, pull: pullRequest("owner/repo"), want: true},
+		{name: "default", policy: "", pull: pullRequest("fork/repo"), want: true},
+		{name: "allow", policy: ForkPolicyAllow, pull: pullRequest("fork/repo"), want: true},
+		{name: "deny", policy: ForkPolicyDeny, pull: pullRequest("fork/repo"), want: false},
+		{name: "deny deleted fork", policy: ForkPolicyDeny, pull: pullRequest(""), want: false},
+		{name: "trusted label", policy: ForkPolicyRequireLabel, pull: pullRequest("fork/repo", "bug", "trusted"), want: true},
+		{name: "no trusted label", policy: ForkPolicyRequireLabel, pull: pullRequest("fork/repo", "bug"), want: false},
+		{name: "trusted label on deleted fork", policy: ForkPolicyRequireLabel, pull: pullRequest("", "trusted"), want: true},
+		{name: "approved", policy: ForkPolicyRequireApproval, pull: pullRequest("fork/repo"), approvals: 1, want: true},
+		{name: "not approved", policy: ForkPolicyRequireApproval, pull: pullRequest("fork/repo"), approvals: 0, want: false},
+		{name: "approved deleted fork", policy: ForkPolicyRequireApproval, pull: pullRequest(""), approvals: 1, want: true},
+		{name: "not approved deleted fork", policy: ForkPolicyRequireApproval, pull: pullRequest(""), approvals: 0, want: false},
+	}
+	for _, tt := range tests {
+		source := Source{ForkPolicy: tt.policy, ForkTrustedLabel: "trusted"}
+		if got := source.FilterFork(tt.pull, tt.approvals); got != tt.want {
+			t.Errorf("%s: FilterFork = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
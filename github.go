@@ -3,17 +3,40 @@ package resource
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v29/github"
 	"golang.org/x/oauth2"
 )
 
 type GithubClient struct {
-	Client *github.Client
-	Repo   string
-	Owner  string
+	Client     *github.Client
+	HTTPClient *http.Client
+	Repo       string
+	Owner      string
+}
+
+// PullRequestLister lists pull requests, their comments and team members.
+// GithubClient implements it with the REST API and GraphQLClient with the
+// GraphQL API.
+type PullRequestLister interface {
+	GetListPullRequests() ([]*github.PullRequest, error)
+	GetListClosedPullRequests(since time.Time) ([]*github.PullRequest, error)
+	GetListIssueComments(number int) ([]*github.IssueComment, error)
+	GetTeamMembers(org string, slug string) ([]*github.User, error)
+}
+
+// CreatePullRequestLister returns the PullRequestLister selected by source.
+func CreatePullRequestLister(source *Source, client *GithubClient) PullRequestLister {
+	if source.UseGraphQL {
+		return NewGraphQLClient(client)
+	}
+	return client
 }
 
 func CreateGithubClient(source *Source) (*GithubClient, error) {
@@ -30,9 +53,10 @@ func CreateGithubClient(source *Source) (*GithubClient, error) {
 	client := github.NewClient(tc)
 
 	return &GithubClient{
-		Client: client,
-		Repo:   repo,
-		Owner:  owner,
+		Client:     client,
+		HTTPClient: tc,
+		Repo:       repo,
+		Owner:      owner,
 	}, nil
 }
 
@@ -64,6 +88,48 @@ func (client *GithubClient) GetListPullRequests() ([]*github.PullRequest, error)
 	return pullRequests, nil
 }
 
+// GetListClosedPullRequests returns the closed and merged pull requests
+// updated at or after since, most recently updated first.
+func (client *GithubClient) GetListClosedPullRequests(since time.Time) ([]*github.PullRequest, error) {
+	var pullRequests []*github.PullRequest
+	opts := &github.PullRequestListOptions{
+		State:     "closed",
+		Sort:      "updated",
+		Direction: "desc",
+	}
+
+	for {
+		pulls, resp, err := client.Client.PullRequests.List(context.TODO(), client.Owner, client.Repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pull := range pulls {
+			if pull.GetUpdatedAt().Before(since) {
+				return pullRequests, nil
+			}
+			pullRequests = append(pullRequests, pull)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return pullRequests, nil
+}
+
+// GetPullRequestState returns the state of a pull request: open, closed or
+// merged.
+func GetPullRequestState(pull *github.PullRequest) string {
+	if pull.GetState() == "open" {
+		return PullRequestOpen
+	}
+	if pull.GetMerged() || pull.MergedAt != nil {
+		return PullRequestMerged
+	}
+	return PullRequestClosed
+}
+
 func (client *GithubClient) GetListIssueComments(number int) ([]*github.IssueComment, error) {
 	opts := &github.IssueListCommentsOptions{}
 	var comments []*github.IssueComment
@@ -83,6 +149,255 @@ func (client *GithubClient) GetListIssueComments(number int) ([]*github.IssueCom
 	return comments, nil
 }
 
+// GetListRepositoryIssueComments returns the comments on every issue and pull
+// request of the repository updated at or after since, oldest first.
+// A zero since returns the whole comment history.
+func (client *GithubClient) GetListRepositoryIssueComments(since time.Time) ([]*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{
+		Sort:      github.String("updated"),
+		Direction: github.String("asc"),
+	}
+	if !since.IsZero() {
+		opts.Since = &since
+	}
+	var comments []*github.IssueComment
+
+	for {
+		cmnts, resp, err := client.Client.Issues.ListComments(context.TODO(), client.Owner, client.Repo, 0, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cmnts...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return comments, nil
+}
+
+// GetNumberFromURL returns the issue or pull request number from its API url.
+func GetNumberFromURL(url string) (int, error) {
+	number, err := strconv.Atoi(path.Base(url))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse number from url '%s': %s", url, err.Error())
+	}
+	return number, nil
+}
+
+// IsNotFound reports whether err is a 404 response from the GitHub API.
+func IsNotFound(err error) bool {
+	if errResp, ok := err.(*github.ErrorResponse); ok {
+		return errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+func (client *GithubClient) GetListPullRequestReviews(number int) ([]*github.PullRequestReview, error) {
+	var reviews []*github.PullRequestReview
+	opts := &github.ListOptions{}
+
+	for {
+		rvws, resp, err := client.Client.PullRequests.ListReviews(context.TODO(), client.Owner, client.Repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, rvws...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return reviews, nil
+}
+
+// GetListPullRequestComments returns the inline review comments of a pull
+// request. A number of 0 lists the review comments of every pull request in
+// the repository updated at or after since, oldest first.
+func (client *GithubClient) GetListPullRequestComments(number int, since time.Time) ([]*github.PullRequestComment, error) {
+	opts := &github.PullRequestListCommentsOptions{}
+	if number == 0 {
+		opts.Sort = "updated"
+		opts.Direction = "asc"
+		opts.Since = since
+	}
+	var comments []*github.PullRequestComment
+
+	for {
+		cmnts, resp, err := client.Client.PullRequests.ListComments(context.TODO(), client.Owner, client.Repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, cmnts...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return comments, nil
+}
+
+// Reaction is a reaction on an issue, pull request or comment. Unlike
+// github.Reaction it carries the time the reaction was added.
+type Reaction struct {
+	ID        int64        `json:"id"`
+	User      *github.User `json:"user"`
+	Content   string       `json:"content"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// GetListIssueReactions returns the reactions on the description of an issue
+// or pull request.
+func (client *GithubClient) GetListIssueReactions(number int) ([]*Reaction, error) {
+	return client.getListReactions(fmt.Sprintf("repos/%s/%s/issues/%d/reactions", client.Owner, client.Repo, number))
+}
+
+// GetListIssueCommentReactions returns the reactions on an issue comment.
+func (client *GithubClient) GetListIssueCommentReactions(id int64) ([]*Reaction, error) {
+	return client.getListReactions(fmt.Sprintf("repos/%s/%s/issues/comments/%d/reactions", client.Owner, client.Repo, id))
+}
+
+func (client *GithubClient) getListReactions(url string) ([]*Reaction, error) {
+	var reactions []*Reaction
+	page := 1
+
+	for {
+		var rcts []*Reaction
+		resp, err := client.getPage(url, "application/vnd.github.squirrel-girl-preview+json", page, &rcts)
+		if err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, rcts...)
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return reactions, nil
+}
+
+// TimelineEvent is an event on the timeline of an issue or pull request.
+// Unlike github.Timeline it carries the reviewer of review_requested events.
+type TimelineEvent struct {
+	ID                int64         `json:"id"`
+	Event             string        `json:"event"`
+	Actor             *github.User  `json:"actor"`
+	CreatedAt         time.Time     `json:"created_at"`
+	Label             *github.Label `json:"label"`
+	RequestedReviewer *github.User  `json:"requested_reviewer"`
+	RequestedTeam     *TimelineTeam `json:"requested_team"`
+}
+
+// TimelineTeam is the team of a review_requested event. Its html_url
+// (https://github.com/orgs/<org>/teams/<slug>) tells the organization when
+// the event does not include it.
+type TimelineTeam struct {
+	github.Team
+	HTMLURL string `json:"html_url"`
+}
+
+// Describe returns a short description of a timeline event such as
+// "labeled: run-e2e", recorded as the comment of the version it triggers.
+func (event *TimelineEvent) Describe() string {
+	switch {
+	case event.Label != nil:
+		return fmt.Sprintf("%s: %s", event.Event, event.Label.GetName())
+	case event.RequestedReviewer != nil:
+		return fmt.Sprintf("%s: %s", event.Event, event.RequestedReviewer.GetLogin())
+	case event.RequestedTeam != nil:
+		return fmt.Sprintf("%s: %s", event.Event, event.RequestedTeam.GetSlug())
+	}
+	return event.Event
+}
+
+// GetOrganizationLogin returns the organization login of a team.
+func (team *TimelineTeam) GetOrganizationLogin() string {
+	if login := team.GetOrganization().GetLogin(); login != "" {
+		return login
+	}
+	parts := strings.Split(team.HTMLURL, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] == "orgs" {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func (client *GithubClient) GetListIssueTimeline(number int) ([]*TimelineEvent, error) {
+	url := fmt.Sprintf("repos/%s/%s/issues/%d/timeline", client.Owner, client.Repo, number)
+	var events []*TimelineEvent
+	page := 1
+
+	for {
+		var evts []*TimelineEvent
+		resp, err := client.getPage(url, "application/vnd.github.mockingbird-preview+json", page, &evts)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evts...)
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return events, nil
+}
+
+// getPage fetches a page of a list endpoint go-github does not fully cover.
+func (client *GithubClient) getPage(url string, accept string, page int, v interface{}) (*github.Response, error) {
+	req, err := client.Client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", url, page), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	return client.Client.Do(context.TODO(), req, v)
+}
+
+// GetListPullRequestFiles returns the paths of the files a pull request
+// changes, including the previous paths of renamed files.
+func (client *GithubClient) GetListPullRequestFiles(number int) ([]string, error) {
+	var files []string
+	opts := &github.ListOptions{}
+
+	for {
+		fls, resp, err := client.Client.PullRequests.ListFiles(context.TODO(), client.Owner, client.Repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range fls {
+			files = append(files, file.GetFilename())
+			if file.GetPreviousFilename() != "" {
+				files = append(files, file.GetPreviousFilename())
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return files, nil
+}
+
+// GetFileContent returns the content of a file of the repository at ref.
+func (client *GithubClient) GetFileContent(path string, ref string) (string, error) {
+	opts := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, _, err := client.Client.Repositories.GetContents(context.TODO(), client.Owner, client.Repo, path, opts)
+	if err != nil {
+		return "", err
+	}
+	if file == nil {
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+	return file.GetContent()
+}
+
 func (client *GithubClient) GetListPullRequestCommits(number int) ([]*github.RepositoryCommit, error) {
 	var commits []*github.RepositoryCommit
 	opts := &github.ListOptions{}
@@ -102,6 +417,56 @@ func (client *GithubClient) GetListPullRequestCommits(number int) ([]*github.Rep
 	return commits, nil
 }
 
+// GetCommitSeenAt returns the earliest time GitHub recorded a commit status
+// or a check suite for a commit, or the zero time if it has none.
+func (client *GithubClient) GetCommitSeenAt(sha string) (time.Time, error) {
+	var seenAt time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (seenAt.IsZero() || t.Before(seenAt)) {
+			seenAt = t
+		}
+	}
+
+	opts := &github.ListOptions{}
+	for {
+		statuses, resp, err := client.Client.Repositories.ListStatuses(context.TODO(), client.Owner, client.Repo, sha, opts)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, status := range statuses {
+			earliest(status.GetCreatedAt())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	url := fmt.Sprintf("repos/%s/%s/commits/%s/check-suites", client.Owner, client.Repo, sha)
+	page := 1
+	for {
+		// go-github does not decode created_at of check suites
+		var suites struct {
+			CheckSuites []struct {
+				CreatedAt time.Time `json:"created_at"`
+			} `json:"check_suites"`
+		}
+		resp, err := client.getPage(url, "application/vnd.github.antiope-preview+json", page, &suites)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, suite := range suites.CheckSuites {
+			earliest(suite.CreatedAt)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return seenAt, nil
+}
+
 func (client *GithubClient) UpdateCommitStatus(ref string, status string, targetURL string, description string, baseContext string, statusContext string) (*github.RepoStatus, error) {
 	if baseContext == "" {
 		baseContext = "concourse-ci"
@@ -137,7 +502,13 @@ func (client *GithubClient) UpdateCommitStatus(ref string, status string, target
 	return repoStatus, nil
 }
 
+// CommentMarker is a hidden marker out appends to the comments it posts so
+// that check never treats them as triggers.
+const CommentMarker = "<!-- concourse-github-pr-comment-hook-resource -->"
+
+// PostComment posts a comment carrying CommentMarker.
 func (client *GithubClient) PostComment(number int, comment string) (*github.IssueComment, error) {
+	comment = comment + "\n\n" + CommentMarker
 	issueComment, _, err := client.Client.Issues.CreateComment(context.TODO(),
 		client.Owner,
 		client.Repo,
@@ -153,6 +524,32 @@ func (client *GithubClient) PostComment(number int, comment string) (*github.Iss
 	return issueComment, nil
 }
 
+// GetPermissionLevel returns the permission of a user on the repository:
+// read, triage, write, maintain, admin or none. A login that is not a user,
+// for which GitHub returns 404, has none.
+func (client *GithubClient) GetPermissionLevel(user string) (string, error) {
+	req, err := client.Client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/collaborators/%s/permission", client.Owner, client.Repo, user), nil)
+	if err != nil {
+		return "", err
+	}
+	// permissionはadmin、write、read、noneの4段階のため、あればrole_nameを使う
+	var level struct {
+		Permission string `json:"permission"`
+		RoleName   string `json:"role_name"`
+	}
+	if _, err := client.Client.Do(context.TODO(), req, &level); err != nil {
+		if IsNotFound(err) {
+			return "none", nil
+		}
+		return "", err
+	}
+	switch level.RoleName {
+	case "read", "triage", "write", "maintain", "admin":
+		return level.RoleName, nil
+	}
+	return level.Permission, nil
+}
+
 func (client *GithubClient) GetTeamMembers(org string, slug string) ([]*github.User, error) {
 	team, _, err := client.Client.Teams.GetTeamBySlug(context.TODO(), org, slug)
 	if err != nil {
@@ -176,3 +573,43 @@ func (client *GithubClient) GetTeamMembers(org string, slug string) ([]*github.U
 
 	return members, nil
 }
+
+func (client *GithubClient) GetTeam(org string, slug string) (*github.Team, error) {
+	team, _, err := client.Client.Teams.GetTeamBySlug(context.TODO(), org, slug)
+	return team, err
+}
+
+// IsTeamMember reports whether user is an active member of a team. A 404 is
+// reported as not a member, but is also returned for a team the access token
+// cannot see, so callers must check the team exists first with GetTeam.
+func (client *GithubClient) IsTeamMember(org string, slug string, user string) (bool, error) {
+	req, err := client.Client.NewRequest("GET", fmt.Sprintf("orgs/%s/teams/%s/memberships/%s", org, slug, user), nil)
+	if err != nil {
+		return false, err
+	}
+	membership := new(github.Membership)
+	if _, err := client.Client.Do(context.TODO(), req, membership); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return membership.GetState() == "active", nil
+}
+
+func (client *GithubClient) IsOrganizationMember(org string, user string) (bool, error) {
+	member, _, err := client.Client.Organizations.IsMember(context.TODO(), org, user)
+	if err != nil {
+		return false, err
+	}
+	return member, nil
+}
+
+// GetAuthenticatedLogin returns the login of the user behind the access token.
+func (client *GithubClient) GetAuthenticatedLogin() (string, error) {
+	user, _, err := client.Client.Users.Get(context.TODO(), "")
+	if err != nil {
+		return "", err
+	}
+	return user.GetLogin(), nil
+}
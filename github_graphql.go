@@ -0,0 +1,431 @@
+package resource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v29/github"
+)
+
+const pullRequestsQuery = `
+query($owner: String!, $name: String!, $states: [PullRequestState!], $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(states: $states, first: 50, after: $cursor, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        number
+        state
+        updatedAt
+        closedAt
+        mergedAt
+        headRefOid
+        headRefName
+        headRepository { nameWithOwner }
+        baseRefName
+        baseRepository { nameWithOwner }
+        isDraft
+        author { login }
+        labels(first: 100) { nodes { name } }
+        comments(first: 100) {
+          pageInfo { hasNextPage endCursor }
+          nodes { id databaseId body createdAt lastEditedAt authorAssociation author { login __typename } }
+        }
+      }
+    }
+  }
+}`
+
+const pullRequestCommentsQuery = `
+query($owner: String!, $name: String!, $number: Int!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      comments(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { id databaseId body createdAt lastEditedAt authorAssociation author { login __typename } }
+      }
+    }
+  }
+}`
+
+const commentEditsQuery = `
+query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on UserContentEditable {
+      userContentEdits(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { diff }
+      }
+    }
+  }
+}`
+
+const teamMembersQuery = `
+query($org: String!, $slug: String!, $cursor: String) {
+  organization(login: $org) {
+    team(slug: $slug) {
+      members(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes { login }
+      }
+    }
+  }
+}`
+
+type graphQLPageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+type graphQLComment struct {
+	ID         string     `json:"id"`
+	DatabaseID int64      `json:"databaseId"`
+	Body       string     `json:"body"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	EditedAt   *time.Time `json:"lastEditedAt"`
+	// AuthorAssociation is reported in the same form as the REST API.
+	AuthorAssociation string `json:"authorAssociation"`
+	Author            struct {
+		Login    string `json:"login"`
+		Typename string `json:"__typename"`
+	} `json:"author"`
+}
+
+type graphQLComments struct {
+	PageInfo graphQLPageInfo  `json:"pageInfo"`
+	Nodes    []graphQLComment `json:"nodes"`
+}
+
+type graphQLRepository struct {
+	NameWithOwner string `json:"nameWithOwner"`
+}
+
+type graphQLPullRequest struct {
+	Number      int        `json:"number"`
+	State       string     `json:"state"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	ClosedAt    *time.Time `json:"closedAt"`
+	MergedAt    *time.Time `json:"mergedAt"`
+	HeadRefOid  string     `json:"headRefOid"`
+	HeadRefName string     `json:"headRefName"`
+	// HeadRepository is null when the fork was deleted.
+	HeadRepository *graphQLRepository `json:"headRepository"`
+	BaseRefName    string             `json:"baseRefName"`
+	BaseRepository *graphQLRepository `json:"baseRepository"`
+	IsDraft        bool               `json:"isDraft"`
+	Author         struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Comments graphQLComments `json:"comments"`
+}
+
+// GraphQLClient implements PullRequestLister with the GitHub GraphQL API,
+// fetching the open pull requests together with their comments so that a
+// poll takes a handful of queries. Everything else goes through the embedded
+// REST client.
+type GraphQLClient struct {
+	*GithubClient
+	Endpoint string
+	comments map[int][]*github.IssueComment
+}
+
+func NewGraphQLClient(client *GithubClient) *GraphQLClient {
+	endpoint := strings.TrimSuffix(client.Client.BaseURL.String(), "/") + "/graphql"
+	return &GraphQLClient{
+		GithubClient: client,
+		Endpoint:     endpoint,
+		comments:     make(map[int][]*github.IssueComment),
+	}
+}
+
+func (client *GraphQLClient) query(query string, variables map[string]interface{}, v interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal graphql query: %s", err.Error())
+	}
+	req, err := http.NewRequest("POST", client.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.HTTPClient.Do(req.WithContext(context.TODO()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("graphql request failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode graphql response: %s", err.Error())
+	}
+	if len(result.Errors) != 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("graphql error: %s", strings.Join(messages, ", "))
+	}
+	return json.Unmarshal(result.Data, v)
+}
+
+func (client *GraphQLClient) GetListPullRequests() ([]*github.PullRequest, error) {
+	return client.getListPullRequests([]string{"OPEN"}, time.Time{})
+}
+
+func (client *GraphQLClient) GetListClosedPullRequests(since time.Time) ([]*github.PullRequest, error) {
+	return client.getListPullRequests([]string{"CLOSED", "MERGED"}, since)
+}
+
+// getListPullRequests lists the pull requests in states updated at or after
+// since, most recently updated first, together with their comments.
+func (client *GraphQLClient) getListPullRequests(states []string, since time.Time) ([]*github.PullRequest, error) {
+	var pullRequests []*github.PullRequest
+	variables := map[string]interface{}{
+		"owner":  client.Owner,
+		"name":   client.Repo,
+		"states": states,
+		"cursor": nil,
+	}
+
+	for {
+		var data struct {
+			Repository struct {
+				PullRequests struct {
+					PageInfo graphQLPageInfo      `json:"pageInfo"`
+					Nodes    []graphQLPullRequest `json:"nodes"`
+				} `json:"pullRequests"`
+			} `json:"repository"`
+		}
+		if err := client.query(pullRequestsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+		for _, node := range data.Repository.PullRequests.Nodes {
+			if node.UpdatedAt.Before(since) {
+				return pullRequests, nil
+			}
+			pullRequests = append(pullRequests, node.toPullRequest())
+			comments := toIssueComments(node.Comments.Nodes)
+			if node.Comments.PageInfo.HasNextPage {
+				rest, err := client.getListIssueComments(node.Number, node.Comments.PageInfo.EndCursor)
+				if err != nil {
+					return nil, err
+				}
+				comments = append(comments, rest...)
+			}
+			client.comments[node.Number] = comments
+		}
+		if !data.Repository.PullRequests.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = data.Repository.PullRequests.PageInfo.EndCursor
+	}
+
+	return pullRequests, nil
+}
+
+// GetListIssueComments returns the comments fetched by GetListPullRequests,
+// querying them only for pull requests it has not listed.
+func (client *GraphQLClient) GetListIssueComments(number int) ([]*github.IssueComment, error) {
+	if comments, ok := client.comments[number]; ok {
+		return comments, nil
+	}
+	comments, err := client.getListIssueComments(number, "")
+	if err != nil {
+		return nil, err
+	}
+	client.comments[number] = comments
+	return comments, nil
+}
+
+func (client *GraphQLClient) getListIssueComments(number int, cursor string) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	variables := map[string]interface{}{
+		"owner":  client.Owner,
+		"name":   client.Repo,
+		"number": number,
+		"cursor": nil,
+	}
+	if cursor != "" {
+		variables["cursor"] = cursor
+	}
+
+	for {
+		var data struct {
+			Repository struct {
+				PullRequest *struct {
+					Comments graphQLComments `json:"comments"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		if err := client.query(pullRequestCommentsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+		if data.Repository.PullRequest == nil {
+			return nil, fmt.Errorf("pull request #%d not found", number)
+		}
+		comments = append(comments, toIssueComments(data.Repository.PullRequest.Comments.Nodes)...)
+		if !data.Repository.PullRequest.Comments.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = data.Repository.PullRequest.Comments.PageInfo.EndCursor
+	}
+
+	return comments, nil
+}
+
+// GetListCommentRevisions returns the bodies of the revisions of an edited
+// comment, the current one included, from its edit history. A revision whose
+// content was deleted from the history is returned as nil.
+func (client *GraphQLClient) GetListCommentRevisions(nodeID string) ([]*string, error) {
+	var revisions []*string
+	variables := map[string]interface{}{
+		"id":     nodeID,
+		"cursor": nil,
+	}
+
+	for {
+		var data struct {
+			Node *struct {
+				UserContentEdits *struct {
+					PageInfo graphQLPageInfo `json:"pageInfo"`
+					Nodes    []struct {
+						Diff *string `json:"diff"`
+					} `json:"nodes"`
+				} `json:"userContentEdits"`
+			} `json:"node"`
+		}
+		if err := client.query(commentEditsQuery, variables, &data); err != nil {
+			return nil, err
+		}
+		if data.Node == nil || data.Node.UserContentEdits == nil {
+			return nil, fmt.Errorf("comment %s not found", nodeID)
+		}
+		for _, node := range data.Node.UserContentEdits.Nodes {
+			revisions = append(revisions, node.Diff)
+		}
+		if !data.Node.UserContentEdits.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = data.Node.UserContentEdits.PageInfo.EndCursor
+	}
+
+	return revisions, nil
+}
+
+func (client *GraphQLClient) GetTeamMembers(org string, slug string) ([]*github.User, error) {
+	var members []*github.User
+	variables := map[string]interface{}{
+		"org":    org,
+		"slug":   slug,
+		"cursor": nil,
+	}
+
+	for {
+		var data struct {
+			Organization *struct {
+				Team *struct {
+					Members struct {
+						PageInfo graphQLPageInfo `json:"pageInfo"`
+						Nodes    []struct {
+							Login string `json:"login"`
+						} `json:"nodes"`
+					} `json:"members"`
+				} `json:"team"`
+			} `json:"organization"`
+		}
+		if err := client.query(teamMembersQuery, variables, &data); err != nil {
+			return nil, err
+		}
+		if data.Organization == nil || data.Organization.Team == nil {
+			return nil, fmt.Errorf("team %s/%s not found", org, slug)
+		}
+		for _, node := range data.Organization.Team.Members.Nodes {
+			members = append(members, &github.User{Login: github.String(node.Login)})
+		}
+		if !data.Organization.Team.Members.PageInfo.HasNextPage {
+			break
+		}
+		variables["cursor"] = data.Organization.Team.Members.PageInfo.EndCursor
+	}
+
+	return members, nil
+}
+
+func (pullRequest *graphQLPullRequest) toPullRequest() *github.PullRequest {
+	labels := make([]*github.Label, 0, len(pullRequest.Labels.Nodes))
+	for _, label := range pullRequest.Labels.Nodes {
+		labels = append(labels, &github.Label{Name: github.String(label.Name)})
+	}
+	state := "open"
+	if pullRequest.State != "OPEN" {
+		state = "closed"
+	}
+	return &github.PullRequest{
+		Number:    github.Int(pullRequest.Number),
+		State:     github.String(state),
+		Merged:    github.Bool(pullRequest.MergedAt != nil),
+		UpdatedAt: &pullRequest.UpdatedAt,
+		ClosedAt:  pullRequest.ClosedAt,
+		MergedAt:  pullRequest.MergedAt,
+		Draft:     github.Bool(pullRequest.IsDraft),
+		User:      &github.User{Login: github.String(pullRequest.Author.Login)},
+		Labels:    labels,
+		Head: &github.PullRequestBranch{
+			Ref:  github.String(pullRequest.HeadRefName),
+			SHA:  github.String(pullRequest.HeadRefOid),
+			Repo: pullRequest.HeadRepository.toRepository(),
+		},
+		Base: &github.PullRequestBranch{
+			Ref:  github.String(pullRequest.BaseRefName),
+			Repo: pullRequest.BaseRepository.toRepository(),
+		},
+	}
+}
+
+func (repository *graphQLRepository) toRepository() *github.Repository {
+	if repository == nil {
+		return nil
+	}
+	return &github.Repository{FullName: github.String(repository.NameWithOwner)}
+}
+
+func toIssueComments(nodes []graphQLComment) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(nodes))
+	for i := range nodes {
+		node := &nodes[i]
+		updatedAt := &node.CreatedAt
+		if node.EditedAt != nil {
+			updatedAt = node.EditedAt
+		}
+		comments = append(comments, &github.IssueComment{
+			ID:                github.Int64(node.DatabaseID),
+			NodeID:            github.String(node.ID),
+			Body:              github.String(node.Body),
+			CreatedAt:         &node.CreatedAt,
+			UpdatedAt:         updatedAt,
+			AuthorAssociation: github.String(node.AuthorAssociation),
+			User:              &github.User{Login: github.String(node.Author.Login), Type: github.String(node.Author.Typename)},
+		})
+	}
+	return comments
+}
@@ -0,0 +1,139 @@
+package resource
+
+import (
+	"regexp"
+	"strings"
+)
+
+var htmlComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// leafBlock matches headings and thematic breaks, which hold no paragraph.
+var leafBlock = regexp.MustCompile(`^(?:#{1,6}(?:[ \t]|$)|(?:[-*_][ \t]*){3,}$)`)
+
+// listItem matches the start of a list item.
+var listItem = regexp.MustCompile(`^(?:[-+*]|[0-9]{1,9}[.)])(?:[ \t]|$)`)
+
+// NormalizeComment removes the parts of a markdown comment that only cite
+// text rather than say it: HTML comments, block quotes with their lazy
+// continuation lines, fenced and indented code blocks and inline code spans.
+// Trigger phrases are matched against the result so that quoting or pasting
+// a command does not run it again.
+func NormalizeComment(body string) string {
+	body = htmlComment.ReplaceAllString(body, "")
+
+	var lines []string
+	fence := ""
+	// paragraph tells whether the previous line is paragraph text, which an
+	// indented code block cannot interrupt, and quoted whether that
+	// paragraph is in a block quote.
+	paragraph, quoted := false, false
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t\r") == "" {
+				fence = ""
+			}
+			continue
+		}
+		if strings.TrimSpace(trimmed) == "" {
+			paragraph, quoted = false, false
+			lines = append(lines, line)
+			continue
+		}
+		if indentWidth(line) >= 4 {
+			// 段落の途中でなければインデントされたコードブロック
+			if !paragraph || quoted {
+				continue
+			}
+			lines = append(lines, removeCodeSpans(line))
+			continue
+		}
+		if marker := fenceMarker(trimmed); marker != "" {
+			fence = marker
+			paragraph, quoted = false, false
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			content := strings.TrimLeft(trimmed, "> \t")
+			paragraph = strings.TrimSpace(content) != "" && fenceMarker(content) == "" && !leafBlock.MatchString(content)
+			quoted = paragraph
+			continue
+		}
+		if quoted && !leafBlock.MatchString(trimmed) && !listItem.MatchString(trimmed) {
+			// 引用の段落の遅延継続行
+			continue
+		}
+		paragraph, quoted = !leafBlock.MatchString(trimmed), false
+		lines = append(lines, removeCodeSpans(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// indentWidth returns the width of the leading spaces and tabs of a line,
+// with tab stops of 4 columns.
+func indentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4 - width%4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// fenceMarker returns the ``` or ~~~ run opening a fenced code block.
+func fenceMarker(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// removeCodeSpans removes the inline code spans of a line. A span opened by
+// a run of backticks is closed by a run of the same length.
+func removeCodeSpans(line string) string {
+	var result strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		n := len(line[start:]) - len(strings.TrimLeft(line[start:], "`"))
+		end := closingBackticks(line[start+n:], n)
+		if end < 0 {
+			result.WriteString(line[:start+n])
+			line = line[start+n:]
+			continue
+		}
+		result.WriteString(line[:start])
+		line = line[start+n+end+n:]
+	}
+	result.WriteString(line)
+	return result.String()
+}
+
+// closingBackticks returns the index of the first run of exactly n
+// backticks in s, or -1.
+func closingBackticks(s string, n int) int {
+	offset := 0
+	for {
+		i := strings.IndexByte(s[offset:], '`')
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+		if run == n {
+			return i
+		}
+		offset = i + run
+	}
+}
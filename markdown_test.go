@@ -0,0 +1,39 @@
+package resource
+
+import "testing"
+
+func TestNormalizeComment(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "/deploy prod", want: "/deploy prod"},
+		{name: "html comment", in: "a<!-- /deploy\n-->b", want: "ab"},
+		{name: "quote", in: "> /deploy\n\nok", want: "\nok"},
+		{name: "nested quote", in: ">> /deploy", want: ""},
+		{name: "lazy quote", in: "> quote\nlazy /deploy", want: ""},
+		{name: "quote ended by blank line", in: "> quote\n\n/deploy", want: "\n/deploy"},
+		{name: "quote ended by list item", in: "> quote\n- /deploy", want: "- /deploy"},
+		{name: "quote ended by heading", in: "> quote\n# /deploy", want: "# /deploy"},
+		{name: "empty quote line is not lazy", in: ">\n/deploy", want: "/deploy"},
+		{name: "backtick fence", in: "```\n/deploy\n```\nok", want: "ok"},
+		{name: "tilde fence", in: "~~~sh\n/deploy\n~~~", want: ""},
+		{name: "longer closing fence", in: "```\n/deploy\n`````\nok", want: "ok"},
+		{name: "shorter fence does not close", in: "````\n```\n/deploy\n````\nok", want: "ok"},
+		{name: "fence in quote", in: "> ```\n> /deploy\n> ```\nok", want: "ok"},
+		{name: "indented code", in: "    /deploy", want: ""},
+		{name: "tab indented code", in: "\t/deploy", want: ""},
+		{name: "indented code after blank line", in: "text\n\n    /deploy", want: "text\n"},
+		{name: "indented paragraph continuation", in: "text\n    /deploy", want: "text\n    /deploy"},
+		{name: "indented fence is code", in: "    ```\n/deploy", want: "/deploy"},
+		{name: "code span", in: "run `/deploy` now", want: "run  now"},
+		{name: "double backtick span", in: "a ``x ` /deploy`` b", want: "a  b"},
+		{name: "unclosed backtick", in: "a ` /deploy", want: "a ` /deploy"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeComment(tt.in); got != tt.want {
+			t.Errorf("%s: NormalizeComment(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
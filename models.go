@@ -3,33 +3,243 @@ package resource
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Source struct {
-	AccessToken   string   `json:"access_token"`
-	Repository    string   `json:"repository"`
-	TriggerPhrase string   `json:"trigger_phrase"`
-	AllowUsers    []string `json:"allow_users"`
+	AccessToken   string    `json:"access_token"`
+	Repository    string    `json:"repository"`
+	TriggerPhrase string    `json:"trigger_phrase"`
+	Commands      []Command `json:"commands"`
+	// MatchLineStart requires trigger_phrase and command patterns to match
+	// at the start of a line.
+	MatchLineStart bool `json:"match_line_start"`
+	Authorization
+	OnHeadMoved  string `json:"on_head_moved"`
+	PollStrategy string `json:"poll_strategy"`
+	UseGraphQL   bool   `json:"use_graphql"`
+	// MembershipCacheTTL is how long team and organization memberships of
+	// commenters are cached in the check container, e.g. "10m". "0"
+	// disables the cache. Defaults to 5 minutes.
+	MembershipCacheTTL string `json:"membership_cache_ttl"`
+	// AllowSelf lets comments of the user behind access_token trigger
+	// versions. They are ignored by default to avoid trigger loops.
+	AllowSelf bool `json:"allow_self"`
+
+	// Pull requests not passing these filters are not checked for triggers.
+	BaseBranch   string   `json:"base_branch"`
+	HeadBranch   string   `json:"head_branch"`
+	Labels       []string `json:"labels"`
+	IgnoreLabels []string `json:"ignore_labels"`
+	IgnoreDrafts bool     `json:"ignore_drafts"`
+	Authors      []string `json:"authors"`
+	// Paths and IgnorePaths are Patterns of changed files. A pull request is
+	// checked only if it changes a file matching paths and not ignore_paths.
+	// A pattern matching a directory matches the files under it.
+	Paths       []string `json:"paths"`
+	IgnorePaths []string `json:"ignore_paths"`
+	// States are the pull request states to check: open, closed and merged.
+	// Defaults to open. Closed and merged pull requests are checked until
+	// closed_max_age after they were closed, 7 days by default.
+	States       []string `json:"states"`
+	ClosedMaxAge string   `json:"closed_max_age"`
+
+	// MaxCommentAge (a duration such as "24h") and IgnoreCommentsBefore (an
+	// RFC3339 time) drop triggers posted before them, including on the first
+	// check.
+	MaxCommentAge        string `json:"max_comment_age"`
+	IgnoreCommentsBefore string `json:"ignore_comments_before"`
+
+	// RequiredApprovals is the number of approving reviews on the commit to
+	// build by owners, members and collaborators other than the pull request
+	// author that a pull request needs before its triggers are accepted.
+	RequiredApprovals int `json:"required_approvals"`
+
+	// ForkPolicy decides whether pull requests from forks, whose code is
+	// built with access_token, may trigger versions: allow (default), deny,
+	// require_label with fork_trusted_label set on the pull request, or
+	// require_approval with an approving review on the commit to build by an
+	// owner, member or collaborator other than the pull request author.
+	ForkPolicy       string `json:"fork_policy"`
+	ForkTrustedLabel string `json:"fork_trusted_label"`
+
+	TriggerOnReviews        bool `json:"trigger_on_reviews"`
+	TriggerOnReviewComments bool `json:"trigger_on_review_comments"`
+
+	TriggerReactions []string `json:"trigger_reactions"`
+	ReactionTargets  []string `json:"reaction_targets"`
+
+	TriggerEvents []EventTrigger `json:"trigger_events"`
+
+	// TriggerOnEdit treats a comment edited after the last version that
+	// newly matches a command as a new trigger. The edit triggers only if no
+	// earlier revision of the comment, read from its GraphQL edit history,
+	// matched the command; edits whose history cannot be read are ignored.
+	TriggerOnEdit bool `json:"trigger_on_edit"`
+}
+
+// Authorization decides who may trigger a version. It is set on the source
+// and may be overridden per command.
+//
+// Entries of allow_users and ignore_users are Patterns matched against logins
+// ignoring case.
+type Authorization struct {
+	AllowUsers []string `json:"allow_users"`
+	// AllowTeams and IgnoreTeams include the members of child teams, as
+	// GitHub reports them as team members.
 	AllowTeams    []Team   `json:"allow_teams"`
 	AllowAllUsers bool     `json:"allow_all_users"`
 	IgnoreUsers   []string `json:"ignore_users"`
 	IgnoreTeams   []Team   `json:"ignore_teams"`
+	// AllowAssociations and IgnoreAssociations match the author_association
+	// GitHub reports for the commenter, e.g. OWNER, MEMBER or COLLABORATOR.
+	// Reactions and timeline events have no author association: they never
+	// match allow_associations and are ignored if ignore_associations is set.
+	AllowAssociations  []string `json:"allow_associations"`
+	IgnoreAssociations []string `json:"ignore_associations"`
+	// MinPermission allows users with at least this permission on the
+	// repository: read, triage, write, maintain or admin.
+	MinPermission string `json:"min_permission"`
+	// AllowOrgs and IgnoreOrgs match members of organizations.
+	AllowOrgs  []string `json:"allow_orgs"`
+	IgnoreOrgs []string `json:"ignore_orgs"`
+	// IgnoreBots ignores users whose GitHub user type is Bot.
+	IgnoreBots bool `json:"ignore_bots"`
+	// CodeOwners allows the code owners of the changed files according to
+	// the CODEOWNERS file of the base branch: of any of them with "any", of
+	// every file that has owners with "all".
+	CodeOwners string `json:"codeowners"`
 }
 
+// CodeOwners values.
+const (
+	CodeOwnersAny = "any"
+	CodeOwnersAll = "all"
+)
+
+// permissionLevels are the repository permissions from lowest to highest.
+var permissionLevels = []string{"read", "triage", "write", "maintain", "admin"}
+
+var authorAssociations = []string{
+	"OWNER",
+	"MEMBER",
+	"COLLABORATOR",
+	"CONTRIBUTOR",
+	"FIRST_TIME_CONTRIBUTOR",
+	"FIRST_TIMER",
+	"NONE",
+}
+
+// Command is a named trigger pattern with its own authorization. Allow
+// settings left empty are inherited from the source; ignore settings add to
+// the source ones.
+type Command struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	// ConfirmPattern makes the command require confirmation: a version is
+	// triggered only when another allowed user posts a comment matching it
+	// within confirm_within, 1 hour by default, of the requesting comment.
+	// It is not supported with poll_strategy repository, which does not list
+	// requests posted before the last version.
+	ConfirmPattern string `json:"confirm_pattern"`
+	ConfirmWithin  string `json:"confirm_within"`
+	Authorization
+}
+
+// OnHeadMoved values decide what check does when the pull request head
+// has moved since the trigger comment was posted.
+//
+// Git commit dates are set by whoever pushes a commit, so they cannot tell
+// which commit was HEAD when a comment was posted. Only reviews and review
+// comments, which GitHub records with their commit, are pinned to an older
+// commit. For other triggers the current HEAD counts as unmoved if GitHub
+// recorded it, by a commit status, check suite or review, at or before the
+// comment.
+const (
+	// HeadMovedPin builds the commit a review or review comment was made on,
+	// and otherwise the current HEAD with a warning if it may have moved.
+	HeadMovedPin = "pin"
+	// HeadMovedReject drops the trigger if HEAD moved or may have moved.
+	HeadMovedReject = "reject"
+	// HeadMovedHead builds the current HEAD.
+	HeadMovedHead = "head"
+)
+
+// ForkPolicy values decide whether pull requests from forks trigger versions.
+const (
+	ForkPolicyAllow           = "allow"
+	ForkPolicyDeny            = "deny"
+	ForkPolicyRequireLabel    = "require_label"
+	ForkPolicyRequireApproval = "require_approval"
+)
+
+// Pull request states.
+const (
+	PullRequestOpen   = "open"
+	PullRequestClosed = "closed"
+	PullRequestMerged = "merged"
+)
+
+// PollStrategy values decide how check finds new comments.
+const (
+	// PollPullRequests lists every open pull request and all of its comments.
+	PollPullRequests = "pull_requests"
+	// PollRepository lists the repository-wide comments updated since the
+	// last version and only looks up the pull requests they belong to.
+	PollRepository = "repository"
+)
+
 type Team struct {
 	Organization string `json:"organization"`
 	Slug         string `json:"slug"`
 }
 
+// EventTrigger selects pull request timeline events that trigger a version,
+// e.g. `labeled` with label `run-e2e` or `ready_for_review`.
+type EventTrigger struct {
+	Event string `json:"event"`
+	// Label restricts labeled/unlabeled events to a label name.
+	Label string `json:"label"`
+	// Reviewer restricts review_requested events to a user login or a team,
+	// either organization/slug or a slug of any organization.
+	Reviewer string `json:"reviewer"`
+}
+
+// Version.Kind values tell which kind of comment triggered a version.
+const (
+	KindIssueComment  = "issue_comment"
+	KindReview        = "review"
+	KindReviewComment = "review_comment"
+	KindReaction      = "reaction"
+	KindEvent         = "event"
+)
+
+// ReactionTargets values tell where check watches for trigger_reactions.
+const (
+	// ReactionTargetBody watches the pull request description.
+	ReactionTargetBody = "body"
+	// ReactionTargetComments watches the pull request issue comments.
+	ReactionTargetComments = "comments"
+)
+
 type Version struct {
 	PR          string    `json:"pr"`
 	Commit      string    `json:"commit"`
 	CommentID   string    `json:"comment_id"`
 	Comment     string    `json:"comment"`
 	CommentedAt time.Time `json:"commented_at"`
+	Kind        string    `json:"kind,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	// EditedAt is set when the version was triggered by editing the comment.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// RequestedBy and ConfirmedBy are set for commands requiring
+	// confirmation. The comment is the requesting one, the comment ID and
+	// time are those of the confirmation.
+	RequestedBy string `json:"requested_by,omitempty"`
+	ConfirmedBy string `json:"confirmed_by,omitempty"`
 }
 
 type MetadataField struct {
@@ -46,15 +256,272 @@ func (source *Source) Validate() error {
 	if source.Repository == "" {
 		return fmt.Errorf("repository must be set")
 	}
-	if source.TriggerPhrase == "" {
-		return fmt.Errorf("trigger_phrase must be set")
+	if source.TriggerPhrase == "" && len(source.Commands) == 0 && len(source.TriggerReactions) == 0 && len(source.TriggerEvents) == 0 {
+		return fmt.Errorf("trigger_phrase, commands, trigger_reactions or trigger_events must be set")
+	}
+	if source.TriggerPhrase != "" || len(source.TriggerReactions) != 0 || len(source.TriggerEvents) != 0 {
+		if !source.Authorization.HasAllow() {
+			return fmt.Errorf("allow_users, allow_teams, allow_associations, allow_orgs, min_permission or codeowners must be set")
+		}
+	}
+	if len(source.TriggerReactions) != 0 || len(source.TriggerEvents) != 0 {
+		// リアクションとイベントにはauthor_associationがない
+		auth := source.Authorization
+		auth.AllowAssociations = nil
+		if !auth.HasAllow() {
+			return fmt.Errorf("allow_associations does not apply to trigger_reactions and trigger_events, allow_users, allow_teams, allow_all_users, allow_orgs, min_permission or codeowners must be set")
+		}
+	}
+	if err := source.Authorization.validate(); err != nil {
+		return err
+	}
+	if _, err := source.CompilePattern(source.TriggerPhrase); err != nil {
+		return fmt.Errorf("invalid trigger_phrase: %s", err.Error())
 	}
-	if !source.AllowAllUsers && len(source.AllowUsers) == 0 && len(source.AllowTeams) == 0 {
-		return fmt.Errorf("allow_users or allow_teams must be set")
+	names := make(map[string]struct{}, len(source.Commands))
+	for _, command := range source.Commands {
+		if command.Name == "" {
+			return fmt.Errorf("commands name must be set")
+		}
+		if _, ok := names[command.Name]; ok {
+			return fmt.Errorf("duplicate command '%s'", command.Name)
+		}
+		names[command.Name] = struct{}{}
+		if command.Pattern == "" {
+			return fmt.Errorf("pattern of command '%s' must be set", command.Name)
+		}
+		if _, err := source.CompilePattern(command.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern of command '%s': %s", command.Name, err.Error())
+		}
+		if !command.HasAllow() && !source.Authorization.HasAllow() {
+			return fmt.Errorf("allow_users, allow_teams, allow_associations, allow_orgs, min_permission or codeowners of command '%s' must be set", command.Name)
+		}
+		if err := command.Authorization.validate(); err != nil {
+			return fmt.Errorf("invalid command '%s': %s", command.Name, err.Error())
+		}
+		if _, err := source.CompilePattern(command.ConfirmPattern); err != nil {
+			return fmt.Errorf("invalid confirm_pattern of command '%s': %s", command.Name, err.Error())
+		}
+		if _, err := command.GetConfirmWithin(); err != nil {
+			return fmt.Errorf("invalid command '%s': %s", command.Name, err.Error())
+		}
+	}
+	switch source.OnHeadMoved {
+	case "", HeadMovedPin, HeadMovedReject, HeadMovedHead:
+	default:
+		return fmt.Errorf("invalid on_head_moved '%s'", source.OnHeadMoved)
+	}
+	for _, branch := range []string{source.BaseBranch, source.HeadBranch} {
+		if _, err := NewPattern(branch, false); err != nil {
+			return fmt.Errorf("invalid branch pattern '%s': %s", branch, err.Error())
+		}
+	}
+	for _, path := range append(append([]string{}, source.Paths...), source.IgnorePaths...) {
+		if _, err := NewPattern(path, false); err != nil {
+			return fmt.Errorf("invalid path pattern '%s': %s", path, err.Error())
+		}
+	}
+	for _, author := range source.Authors {
+		if _, err := NewPattern(author, true); err != nil {
+			return fmt.Errorf("invalid author pattern '%s': %s", author, err.Error())
+		}
+	}
+	for _, state := range source.States {
+		if state != PullRequestOpen && state != PullRequestClosed && state != PullRequestMerged {
+			return fmt.Errorf("invalid states '%s'", state)
+		}
+	}
+	if _, err := source.GetClosedMaxAge(); err != nil {
+		return err
+	}
+	if _, err := source.GetCommentCutoff(time.Now()); err != nil {
+		return err
+	}
+	if source.RequiredApprovals < 0 {
+		return fmt.Errorf("required_approvals must not be negative")
+	}
+	switch source.ForkPolicy {
+	case "", ForkPolicyAllow, ForkPolicyDeny, ForkPolicyRequireApproval:
+	case ForkPolicyRequireLabel:
+		if source.ForkTrustedLabel == "" {
+			return fmt.Errorf("fork_trusted_label must be set for fork_policy '%s'", source.ForkPolicy)
+		}
+	default:
+		return fmt.Errorf("invalid fork_policy '%s'", source.ForkPolicy)
+	}
+	if _, err := source.GetMembershipCacheTTL(); err != nil {
+		return err
+	}
+	switch source.PollStrategy {
+	case "", PollPullRequests, PollRepository:
+	default:
+		return fmt.Errorf("invalid poll_strategy '%s'", source.PollStrategy)
+	}
+	if source.TriggerOnReviews && source.GetPollStrategy() == PollRepository {
+		return fmt.Errorf("trigger_on_reviews is not supported with poll_strategy '%s'", PollRepository)
+	}
+	if len(source.TriggerReactions) != 0 && source.GetPollStrategy() == PollRepository {
+		return fmt.Errorf("trigger_reactions is not supported with poll_strategy '%s'", PollRepository)
+	}
+	if len(source.TriggerEvents) != 0 && source.GetPollStrategy() == PollRepository {
+		return fmt.Errorf("trigger_events is not supported with poll_strategy '%s'", PollRepository)
+	}
+	for _, command := range source.Commands {
+		// 前回のversionより前の依頼コメントを取得できない
+		if command.ConfirmPattern != "" && source.GetPollStrategy() == PollRepository {
+			return fmt.Errorf("confirm_pattern of command '%s' is not supported with poll_strategy '%s'", command.Name, PollRepository)
+		}
+	}
+	for _, event := range source.TriggerEvents {
+		if event.Event == "" {
+			return fmt.Errorf("trigger_events event must be set")
+		}
+	}
+	for _, target := range source.ReactionTargets {
+		if target != ReactionTargetBody && target != ReactionTargetComments {
+			return fmt.Errorf("invalid reaction_targets '%s'", target)
+		}
 	}
 	return nil
 }
 
+// GetCommands returns the commands to match comments against with their
+// effective authorization. trigger_phrase is returned first as an unnamed
+// command using the source authorization.
+func (source *Source) GetCommands() []Command {
+	var commands []Command
+	if source.TriggerPhrase != "" {
+		commands = append(commands, Command{
+			Pattern:       source.TriggerPhrase,
+			Authorization: source.Authorization,
+		})
+	}
+	for _, command := range source.Commands {
+		command.Authorization = source.Authorization.Merge(&command.Authorization)
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// CompilePattern compiles trigger_phrase or a command pattern, anchoring it
+// at the start of a line when match_line_start is set.
+func (source *Source) CompilePattern(pattern string) (*regexp.Regexp, error) {
+	if source.MatchLineStart {
+		pattern = `(?m)^[ \t]*(?:` + pattern + `)`
+	}
+	return regexp.Compile(pattern)
+}
+
+// GetCommand returns the command with the given name, the unnamed one being
+// trigger_phrase.
+func (source *Source) GetCommand(name string) (*Command, bool) {
+	for _, command := range source.GetCommands() {
+		if command.Name == name {
+			return &command, true
+		}
+	}
+	return nil, false
+}
+
+func (command *Command) GetConfirmWithin() (time.Duration, error) {
+	if command.ConfirmWithin == "" {
+		return time.Hour, nil
+	}
+	within, err := time.ParseDuration(command.ConfirmWithin)
+	if err != nil {
+		return 0, fmt.Errorf("invalid confirm_within '%s': %s", command.ConfirmWithin, err.Error())
+	}
+	return within, nil
+}
+
+// HasAllow reports whether any allow setting is set.
+func (auth *Authorization) HasAllow() bool {
+	return auth.AllowAllUsers || len(auth.AllowUsers) != 0 || len(auth.AllowTeams) != 0 || len(auth.AllowAssociations) != 0 || auth.MinPermission != "" || len(auth.AllowOrgs) != 0 || auth.CodeOwners != ""
+}
+
+func (auth *Authorization) validate() error {
+	for _, users := range [][]string{auth.AllowUsers, auth.IgnoreUsers} {
+		for _, user := range users {
+			if _, err := NewPattern(user, true); err != nil {
+				return fmt.Errorf("invalid user pattern '%s': %s", user, err.Error())
+			}
+		}
+	}
+	if auth.MinPermission != "" && !containsString(permissionLevels, auth.MinPermission) {
+		return fmt.Errorf("invalid min_permission '%s'", auth.MinPermission)
+	}
+	switch auth.CodeOwners {
+	case "", CodeOwnersAny, CodeOwnersAll:
+	default:
+		return fmt.Errorf("invalid codeowners '%s'", auth.CodeOwners)
+	}
+	for _, associations := range [][]string{auth.AllowAssociations, auth.IgnoreAssociations} {
+		for _, association := range associations {
+			if !containsString(authorAssociations, strings.ToUpper(association)) {
+				return fmt.Errorf("invalid author association '%s'", association)
+			}
+		}
+	}
+	return nil
+}
+
+// HasPermission reports whether permission is at least minPermission.
+// Unknown permissions such as none have no access.
+func HasPermission(permission string, minPermission string) bool {
+	level := -1
+	for i, p := range permissionLevels {
+		if p == permission {
+			level = i
+		}
+		if p == minPermission {
+			return level >= 0
+		}
+	}
+	return false
+}
+
+// HasAssociation reports whether association is one of associations,
+// ignoring case.
+func HasAssociation(associations []string, association string) bool {
+	for _, a := range associations {
+		if strings.EqualFold(a, association) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Merge returns the authorization of a command overriding auth: the allow
+// settings of override replace those of auth when set, and the ignore
+// settings of both apply.
+func (auth *Authorization) Merge(override *Authorization) Authorization {
+	merged := *auth
+	if override.HasAllow() {
+		merged.AllowUsers = override.AllowUsers
+		merged.AllowTeams = override.AllowTeams
+		merged.AllowAllUsers = override.AllowAllUsers
+		merged.AllowAssociations = override.AllowAssociations
+		merged.MinPermission = override.MinPermission
+		merged.AllowOrgs = override.AllowOrgs
+		merged.CodeOwners = override.CodeOwners
+	}
+	merged.IgnoreUsers = append(append([]string{}, auth.IgnoreUsers...), override.IgnoreUsers...)
+	merged.IgnoreTeams = append(append([]Team{}, auth.IgnoreTeams...), override.IgnoreTeams...)
+	merged.IgnoreAssociations = append(append([]string{}, auth.IgnoreAssociations...), override.IgnoreAssociations...)
+	merged.IgnoreOrgs = append(append([]string{}, auth.IgnoreOrgs...), override.IgnoreOrgs...)
+	merged.IgnoreBots = auth.IgnoreBots || override.IgnoreBots
+	return merged
+}
+
 func (source *Source) GetOwnerRepo() (string, string, error) {
 	slice := strings.Split(source.Repository, "/")
 	if len(slice) != 2 {
@@ -63,6 +530,98 @@ func (source *Source) GetOwnerRepo() (string, string, error) {
 	return slice[0], slice[1], nil
 }
 
+func (source *Source) GetOnHeadMoved() string {
+	if source.OnHeadMoved == "" {
+		return HeadMovedPin
+	}
+	return source.OnHeadMoved
+}
+
+func (source *Source) GetMembershipCacheTTL() (time.Duration, error) {
+	if source.MembershipCacheTTL == "" {
+		return 5 * time.Minute, nil
+	}
+	ttl, err := time.ParseDuration(source.MembershipCacheTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid membership_cache_ttl '%s': %s", source.MembershipCacheTTL, err.Error())
+	}
+	return ttl, nil
+}
+
+func (source *Source) GetStates() []string {
+	if len(source.States) == 0 {
+		return []string{PullRequestOpen}
+	}
+	return source.States
+}
+
+// HasState reports whether pull requests in state are checked.
+func (source *Source) HasState(state string) bool {
+	return containsString(source.GetStates(), state)
+}
+
+func (source *Source) GetClosedMaxAge() (time.Duration, error) {
+	if source.ClosedMaxAge == "" {
+		return 7 * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(source.ClosedMaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("invalid closed_max_age '%s': %s", source.ClosedMaxAge, err.Error())
+	}
+	return age, nil
+}
+
+// GetCommentCutoff returns the time before which triggers are dropped
+// according to max_comment_age and ignore_comments_before, or the zero time.
+func (source *Source) GetCommentCutoff(now time.Time) (time.Time, error) {
+	var cutoff time.Time
+	if source.IgnoreCommentsBefore != "" {
+		before, err := time.Parse(time.RFC3339, source.IgnoreCommentsBefore)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid ignore_comments_before '%s': %s", source.IgnoreCommentsBefore, err.Error())
+		}
+		cutoff = before
+	}
+	if source.MaxCommentAge != "" {
+		age, err := time.ParseDuration(source.MaxCommentAge)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid max_comment_age '%s': %s", source.MaxCommentAge, err.Error())
+		}
+		if t := now.Add(-age); t.After(cutoff) {
+			cutoff = t
+		}
+	}
+	return cutoff, nil
+}
+
+func (source *Source) GetForkPolicy() string {
+	if source.ForkPolicy == "" {
+		return ForkPolicyAllow
+	}
+	return source.ForkPolicy
+}
+
+func (source *Source) GetPollStrategy() string {
+	if source.PollStrategy == "" {
+		return PollPullRequests
+	}
+	return source.PollStrategy
+}
+
+// GetReactionTargets returns where to watch for trigger_reactions,
+// defaulting to the pull request description.
+func (source *Source) GetReactionTargets() []string {
+	if len(source.ReactionTargets) == 0 {
+		return []string{ReactionTargetBody}
+	}
+	return source.ReactionTargets
+}
+
+// IsTriggerReaction reports whether content is one of trigger_reactions.
+func (source *Source) IsTriggerReaction(content string) bool {
+	return containsString(source.TriggerReactions, content)
+}
+
 func (version *Version) GetPR() (int, error) {
 	number, err := strconv.Atoi(version.PR)
 	if err != nil {
@@ -78,3 +637,62 @@ func (version *Version) GetCommentID() (int64, error) {
 	}
 	return id, nil
 }
+
+// GetKind returns the kind of comment that triggered the version.
+// Versions emitted before kinds were recorded are issue comments.
+func (version *Version) GetKind() string {
+	if version.Kind == "" {
+		return KindIssueComment
+	}
+	return version.Kind
+}
+
+// TriggeredAt returns the time the comment was posted, or edited for
+// versions triggered by an edit.
+func (version *Version) TriggeredAt() time.Time {
+	if version.EditedAt != nil {
+		return *version.EditedAt
+	}
+	return version.CommentedAt
+}
+
+// Less reports whether version was triggered before other. Comment IDs are
+// only ordered within a kind, so versions are ordered by time first.
+func (version *Version) Less(other *Version) bool {
+	if !version.TriggeredAt().Equal(other.TriggeredAt()) {
+		return version.TriggeredAt().Before(other.TriggeredAt())
+	}
+	if version.GetKind() != other.GetKind() {
+		return version.GetKind() < other.GetKind()
+	}
+	a, _ := version.GetCommentID()
+	b, _ := other.GetCommentID()
+	if a != b {
+		return a < b
+	}
+	return version.Command < other.Command
+}
+
+// Match reports whether a timeline event is selected by the trigger.
+func (trigger *EventTrigger) Match(event *TimelineEvent) bool {
+	if trigger.Event != event.Event {
+		return false
+	}
+	if trigger.Label != "" && (event.Label == nil || event.Label.GetName() != trigger.Label) {
+		return false
+	}
+	if trigger.Reviewer != "" {
+		if event.RequestedReviewer != nil {
+			return event.RequestedReviewer.GetLogin() == trigger.Reviewer
+		}
+		if event.RequestedTeam != nil {
+			slash := strings.Index(trigger.Reviewer, "/")
+			if slash < 0 {
+				return event.RequestedTeam.GetSlug() == trigger.Reviewer
+			}
+			return strings.EqualFold(event.RequestedTeam.GetOrganizationLogin(), trigger.Reviewer[:slash]) && event.RequestedTeam.GetSlug() == trigger.Reviewer[slash+1:]
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package resource
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestVersionLess(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	t2 := t0.Add(2 * time.Minute)
+
+	tests := []struct {
+		name string
+		a, b Version
+		want bool
+	}{
+		{
+			name: "earlier comment",
+			a:    Version{CommentID: "2", CommentedAt: t0},
+			b:    Version{CommentID: "1", CommentedAt: t1},
+			want: true,
+		},
+		{
+			name: "later comment",
+			a:    Version{CommentID: "1", CommentedAt: t1},
+			b:    Version{CommentID: "2", CommentedAt: t0},
+			want: false,
+		},
+		{
+			name: "numeric comment id",
+			a:    Version{CommentID: "9", CommentedAt: t0},
+			b:    Version{CommentID: "10", CommentedAt: t0},
+			want: true,
+		},
+		{
+			name: "numeric comment id reversed",
+			a:    Version{CommentID: "10", CommentedAt: t0},
+			b:    Version{CommentID: "9", CommentedAt: t0},
+			want: false,
+		},
+		{
+			name: "kind before comment id",
+			a:    Version{CommentID: "9", CommentedAt: t0, Kind: KindIssueComment},
+			b:    Version{CommentID: "1", CommentedAt: t0, Kind: KindReview},
+			want: true,
+		},
+		{
+			name: "empty kind is issue comment",
+			a:    Version{CommentID: "1", CommentedAt: t0},
+			b:    Version{CommentID: "2", CommentedAt: t0, Kind: KindIssueComment},
+			want: true,
+		},
+		{
+			name: "edit time",
+			a:    Version{CommentID: "1", CommentedAt: t0, EditedAt: &t2},
+			b:    Version{CommentID: "2", CommentedAt: t1},
+			want: false,
+		},
+		{
+			name: "edit of the same comment",
+			a:    Version{CommentID: "1", CommentedAt: t0},
+			b:    Version{CommentID: "1", CommentedAt: t0, EditedAt: &t1},
+			want: true,
+		},
+		{
+			name: "command",
+			a:    Version{CommentID: "1", CommentedAt: t0, Command: "build"},
+			b:    Version{CommentID: "1", CommentedAt: t0, Command: "deploy"},
+			want: true,
+		},
+		{
+			name: "equal",
+			a:    Version{CommentID: "1", CommentedAt: t0},
+			b:    Version{CommentID: "1", CommentedAt: t0},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(&tt.b); got != tt.want {
+			t.Errorf("%s: Less = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEventTriggerMatchTeam(t *testing.T) {
+	team := func(org string, url string) *TimelineEvent {
+		var event TimelineEvent
+		body := `{"event": "review_requested", "requested_team": {"slug": "core", "html_url": "` + url + `"`
+		if org != "" {
+			body += `, "organization": {"login": "` + org + `"}`
+		}
+		if err := json.Unmarshal([]byte(body+`}}`), &event); err != nil {
+			t.Fatal(err)
+		}
+		return &event
+	}
+	tests := []struct {
+		reviewer string
+		event    *TimelineEvent
+		want     bool
+	}{
+		{reviewer: "core", event: team("acme", ""), want: true},
+		{reviewer: "acme/core", event: team("acme", ""), want: true},
+		{reviewer: "other/core", event: team("acme", ""), want: false},
+		{reviewer: "acme/core", event: team("", "https://github.com/orgs/acme/teams/core"), want: true},
+		{reviewer: "other/core", event: team("", "https://github.com/orgs/acme/teams/core"), want: false},
+		{reviewer: "acme/core", event: team("", ""), want: false},
+		{reviewer: "acme/web", event: team("acme", ""), want: false},
+	}
+	for _, tt := range tests {
+		trigger := EventTrigger{Event: "review_requested", Reviewer: tt.reviewer}
+		if got := trigger.Match(tt.event); got != tt.want {
+			t.Errorf("Match(%q, %s/%s) = %v, want %v", tt.reviewer, tt.event.RequestedTeam.GetOrganizationLogin(), tt.event.RequestedTeam.GetSlug(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package resource
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Pattern matches names such as user logins, branches and file paths. It is
+// either a glob, where `*` matches any run of characters but `/`, `**` any
+// run of characters, `**/` any directories including none and `?` one
+// character but `/`, or a regular expression
+// enclosed in slashes such as `/^renovate-.*$/`. Other characters of a glob,
+// including `[` and `]`, match themselves so that `*[bot]` matches bot users.
+type Pattern struct {
+	re *regexp.Regexp
+}
+
+// NewPattern compiles a glob or /regex/ pattern, optionally ignoring case.
+func NewPattern(pattern string, ignoreCase bool) (*Pattern, error) {
+	var expr string
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	} else {
+		expr = "^" + globToRegexp(pattern) + "$"
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Pattern{re: re}, nil
+}
+
+func (pattern *Pattern) Match(s string) bool {
+	return pattern.re.MatchString(s)
+}
+
+// MatchPatterns reports whether s matches any of patterns. Invalid patterns
+// never match; they are reported by Source.Validate.
+func MatchPatterns(patterns []string, s string, ignoreCase bool) bool {
+	for _, p := range patterns {
+		pattern, err := NewPattern(p, ignoreCase)
+		if err != nil {
+			continue
+		}
+		if pattern.Match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch glob[i] {
+		case '*':
+			if i+2 < len(glob) && glob[i+1] == '*' && glob[i+2] == '/' {
+				// **/ also matches no directory
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if i+1 < len(glob) && glob[i+1] == '*' {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return expr.String()
+}
@@ -0,0 +1,64 @@
+package resource
+
+import "testing"
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		ignoreCase bool
+		s          string
+		want       bool
+	}{
+		{pattern: "alice", s: "alice", want: true},
+		{pattern: "alice", s: "alice2", want: false},
+		{pattern: "alice", s: "Alice", want: false},
+		{pattern: "alice", ignoreCase: true, s: "Alice", want: true},
+		{pattern: "release/*", s: "release/1.0", want: true},
+		{pattern: "release/*", s: "release/1.0/hotfix", want: false},
+		{pattern: "release/**", s: "release/1.0/hotfix", want: true},
+		{pattern: "src/**/test.go", s: "src/test.go", want: true},
+		{pattern: "src/**/test.go", s: "src/a/b/test.go", want: true},
+		{pattern: "src/**/test.go", s: "srctest.go", want: false},
+		{pattern: "v?", s: "v1", want: true},
+		{pattern: "v?", s: "v10", want: false},
+		{pattern: "a?b", s: "a/b", want: false},
+		{pattern: "*[bot]", s: "renovate[bot]", want: true},
+		{pattern: "*[bot]", s: "renovateb", want: false},
+		{pattern: "a.b", s: "axb", want: false},
+		{pattern: "a+b", s: "a+b", want: true},
+		{pattern: "ユーザー*", s: "ユーザー1", want: true},
+		{pattern: "/^renovate-.*$/", s: "renovate-bot", want: true},
+		{pattern: "/^renovate-.*$/", s: "my-renovate-bot", want: false},
+		{pattern: "/bot/", s: "my-bot-user", want: true},
+		{pattern: "/BOT/", ignoreCase: true, s: "bot", want: true},
+		{pattern: "/", s: "/", want: true},
+	}
+	for _, tt := range tests {
+		pattern, err := NewPattern(tt.pattern, tt.ignoreCase)
+		if err != nil {
+			t.Errorf("NewPattern(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if got := pattern.Match(tt.s); got != tt.want {
+			t.Errorf("NewPattern(%q, %v).Match(%q) = %v, want %v", tt.pattern, tt.ignoreCase, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestNewPatternInvalidRegexp(t *testing.T) {
+	if _, err := NewPattern("/(/", false); err == nil {
+		t.Errorf("NewPattern with an invalid regexp succeeded")
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	if !MatchPatterns([]string{"/(/", "bob", "al*"}, "alice", false) {
+		t.Errorf("MatchPatterns did not match alice")
+	}
+	if MatchPatterns([]string{"/(/"}, "(", false) {
+		t.Errorf("MatchPatterns matched an invalid pattern")
+	}
+	if MatchPatterns(nil, "alice", false) {
+		t.Errorf("MatchPatterns matched no patterns")
+	}
+}